@@ -0,0 +1,381 @@
+// Package journal keeps a rect.BVol durable with a write-ahead log and snapshots.
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+
+	"github.com/briannoyama/bvh/rect"
+)
+
+const (
+	ADD    byte = 1
+	REMOVE byte = 2
+	UPDATE byte = 3
+)
+
+const (
+	logName      = "log"
+	snapshotName = "snapshot"
+)
+
+// An operation is its kind and ID, then the bounds for ADD and UPDATE, then a
+// CRC-32 of the bytes before it.
+const removeSize = 1 + 8 + 4
+const boundsSize = 8 * rect.DIMENSIONS
+const addSize = removeSize + boundsSize
+
+// ErrBroken is returned by operations after a failed write to the log could not
+// be undone. Snapshot, or reopen the journal, to keep every operation that
+// succeeded.
+var ErrBroken = errors.New("journal: log damaged by a failed write")
+
+// ErrCorrupt is returned by Open when an operation before the last one in the
+// log is damaged. The log is left as it is, since operations after the damage
+// may still be recovered from it.
+var ErrCorrupt = errors.New("journal: log damaged before its last operation")
+
+// The log file. Tests replace it to fail writes.
+type logFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Options configure a Journal.
+type Options struct {
+	// Snapshot after this many operations. Zero snapshots only when asked.
+	SnapshotEvery int
+	// Sync the log to disk after each operation, so that operations survive an
+	// operating system crash as well as a crash of the process.
+	Sync bool
+	// Metric for the hierarchy to choose where to add orthotopes. Defaults to
+	// rect.ScoreMetric.
+	Metric rect.Metric
+	// Insertion for the hierarchy to search for where to add orthotopes.
+	// Defaults to rect.GREEDY.
+	Insertion rect.Insertion
+}
+
+// A Journal is a hierarchy of orthotopes identified by ID, where each change is
+// appended to a log before it is applied. Open recovers the last snapshot plus
+// every complete operation logged after it. A Journal is not safe for
+// concurrent use; wrap its use in a lock, or query snapshots of BVol.
+type Journal struct {
+	dir   string
+	opts  Options
+	log   logFile
+	bvol  *rect.BVol
+	orths map[uint64]*rect.Orthotope
+	ids   map[*rect.Orthotope]uint64
+	// Operations logged since the last snapshot.
+	logged int
+	// The length of the log up to the end of the last operation.
+	size int64
+	// Set once the log can not be restored to size after a failed write.
+	broken error
+	// The error of the last snapshot taken for SnapshotEvery.
+	snapshotErr error
+}
+
+// Open recovers the journal in dir, creating it if needed. A partly written
+// operation at the end of the log, as left by a crash, is discarded. Damage to
+// any earlier operation returns ErrCorrupt without changing the log.
+func Open(dir string, opts Options) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	j := &Journal{dir: dir, opts: opts, bvol: &rect.BVol{},
+		orths: map[uint64]*rect.Orthotope{}, ids: map[*rect.Orthotope]uint64{}}
+	if err := j.readSnapshot(); err != nil {
+		return nil, err
+	}
+	j.bvol.SetMetric(opts.Metric)
+	j.bvol.SetInsertion(opts.Insertion)
+
+	log, err := os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(log)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	good, err := j.replay(data)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	// Drop any torn operation so that new ones follow the last good one.
+	if err := log.Truncate(int64(good)); err != nil {
+		log.Close()
+		return nil, err
+	}
+	if _, err := log.Seek(int64(good), io.SeekStart); err != nil {
+		log.Close()
+		return nil, err
+	}
+	j.log = log
+	j.size = int64(good)
+	return j, nil
+}
+
+func (j *Journal) readSnapshot() error {
+	file, err := os.Open(filepath.Join(j.dir, snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	bvol, err := rect.Decode(file, func(id uint64, bounds rect.Orthotope) *rect.Orthotope {
+		orth := &bounds
+		j.orths[id] = orth
+		j.ids[orth] = id
+		return orth
+	})
+	if err != nil {
+		return err
+	}
+	j.bvol = bvol
+	return nil
+}
+
+// Applies each complete operation in data, returning the length of those. Only
+// the last operation may be damaged, as a crash while writing it leaves it;
+// damage anywhere before returns ErrCorrupt.
+func (j *Journal) replay(data []byte) (int, error) {
+	good := 0
+	for len(data) > 0 {
+		size := removeSize
+		if data[0] != REMOVE {
+			size = addSize
+		}
+		damaged := len(data) < size || (data[0] != ADD && data[0] != REMOVE &&
+			data[0] != UPDATE)
+		if !damaged {
+			damaged = crc32.ChecksumIEEE(data[:size-4]) !=
+				binary.LittleEndian.Uint32(data[size-4:size])
+		}
+		if damaged && len(data) > size {
+			return 0, fmt.Errorf("%w: operation at byte %d", ErrCorrupt, good)
+		} else if damaged {
+			break
+		}
+		record := data[:size]
+		id := binary.LittleEndian.Uint64(record[1:])
+		bounds := rect.Orthotope{}
+		if record[0] != REMOVE {
+			for index := 0; index < rect.DIMENSIONS; index++ {
+				bounds.Point[index] = int32(binary.LittleEndian.Uint32(
+					record[9+4*index:]))
+				bounds.Delta[index] = int32(binary.LittleEndian.Uint32(
+					record[9+4*(rect.DIMENSIONS+index):]))
+			}
+		}
+		j.apply(record[0], id, bounds)
+		j.logged++
+		good += size
+		data = data[size:]
+	}
+	return good, nil
+}
+
+// Applies an operation. Operations set the state of their ID outright, so
+// replaying ones already in a snapshot changes nothing: ADD and UPDATE both
+// place the ID at bounds, and REMOVE of a missing ID does nothing.
+func (j *Journal) apply(op byte, id uint64, bounds rect.Orthotope) {
+	if orth := j.orths[id]; orth != nil {
+		j.bvol.Remove(orth)
+		delete(j.ids, orth)
+		delete(j.orths, id)
+	}
+	if op != REMOVE {
+		orth := &bounds
+		j.bvol.Add(orth)
+		j.orths[id] = orth
+		j.ids[orth] = id
+	}
+}
+
+// Logs then applies an operation, snapshotting when due. The operation is
+// durable once logged, so a failed snapshot is kept for SnapshotErr rather than
+// returned.
+func (j *Journal) write(op byte, id uint64, bounds rect.Orthotope) error {
+	record := make([]byte, 0, addSize)
+	record = append(record, op)
+	record = binary.LittleEndian.AppendUint64(record, id)
+	if op != REMOVE {
+		for _, p := range bounds.Point {
+			record = binary.LittleEndian.AppendUint32(record, uint32(p))
+		}
+		for _, d := range bounds.Delta {
+			record = binary.LittleEndian.AppendUint32(record, uint32(d))
+		}
+	}
+	record = binary.LittleEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+	if j.broken != nil {
+		return j.broken
+	}
+	if _, err := j.log.Write(record); err != nil {
+		return j.rewind(err)
+	}
+	if j.opts.Sync {
+		if err := j.log.Sync(); err != nil {
+			return j.rewind(err)
+		}
+	}
+	j.size += int64(len(record))
+	j.apply(op, id, bounds)
+	j.logged++
+	if j.opts.SnapshotEvery > 0 && j.logged >= j.opts.SnapshotEvery {
+		j.snapshotErr = j.Snapshot()
+	}
+	return nil
+}
+
+// SnapshotErr returns the error of the last snapshot taken because of
+// SnapshotEvery, or nil if it succeeded. A failed snapshot is retried after the
+// next operation.
+func (j *Journal) SnapshotErr() error {
+	return j.snapshotErr
+}
+
+// Cuts any part of a failed operation from the log, so that later operations
+// directly follow the last good one rather than torn bytes that would end
+// replay early. If the log can not be cut, the journal rejects further
+// operations. Returns err.
+func (j *Journal) rewind(err error) error {
+	if cut := j.cut(j.size); cut != nil {
+		j.broken = errors.Join(ErrBroken, err, cut)
+	}
+	return err
+}
+
+// Truncates the log to size and moves its offset there.
+func (j *Journal) cut(size int64) error {
+	if err := j.log.Truncate(size); err != nil {
+		return err
+	}
+	_, err := j.log.Seek(size, io.SeekStart)
+	return err
+}
+
+// Add the orthotope bounds under id, replacing any already under id.
+func (j *Journal) Add(id uint64, bounds rect.Orthotope) error {
+	return j.write(ADD, id, bounds)
+}
+
+// Update moves the orthotope under id to bounds.
+func (j *Journal) Update(id uint64, bounds rect.Orthotope) error {
+	return j.write(UPDATE, id, bounds)
+}
+
+// Remove the orthotope under id, if any.
+func (j *Journal) Remove(id uint64) error {
+	return j.write(REMOVE, id, rect.Orthotope{})
+}
+
+// Snapshot writes the whole hierarchy to disk and empties the log. The snapshot
+// replaces the old one atomically, and a crash before the log is emptied only
+// means replaying operations the snapshot already holds.
+func (j *Journal) Snapshot() error {
+	buf := &bytes.Buffer{}
+	if err := j.bvol.Encode(buf, func(orth *rect.Orthotope) uint64 {
+		return j.ids[orth]
+	}); err != nil {
+		return err
+	}
+	path := filepath.Join(j.dir, snapshotName)
+	if err := writeSynced(path+".tmp", buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if err := syncDir(j.dir); err != nil {
+		return err
+	}
+	if err := j.cut(0); err != nil {
+		j.broken = errors.Join(ErrBroken, err)
+		return err
+	}
+	// The snapshot holds every operation, so emptying the log also repairs it.
+	j.broken = nil
+	j.size = 0
+	j.logged = 0
+	return j.log.Sync()
+}
+
+func writeSynced(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Syncs a directory so that a rename within it is durable. Not every platform
+// supports this, so failures to sync are ignored.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	file.Sync()
+	return file.Close()
+}
+
+// Close the log. The journal must not be used afterwards.
+func (j *Journal) Close() error {
+	return j.log.Close()
+}
+
+// Len returns the number of orthotopes in the journal.
+func (j *Journal) Len() int {
+	return len(j.orths)
+}
+
+// Get returns the bounds under id.
+func (j *Journal) Get(id uint64) (rect.Orthotope, bool) {
+	orth := j.orths[id]
+	if orth == nil {
+		return rect.Orthotope{}, false
+	}
+	return *orth, true
+}
+
+// Query returns a sequence of the IDs of the orthotopes that overlap o.
+func (j *Journal) Query(o *rect.Orthotope) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for orth := range j.bvol.Query(o) {
+			if !yield(j.ids[orth]) {
+				return
+			}
+		}
+	}
+}
+
+// BVol returns the hierarchy for other reads. It must not be modified, or used
+// after further operations on the journal.
+func (j *Journal) BVol() *rect.BVol {
+	return j.bvol
+}
@@ -0,0 +1,365 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/briannoyama/bvh/rect"
+)
+
+type state map[uint64]rect.Orthotope
+
+var all = &rect.Orthotope{Point: [3]int32{-1, -1, -1},
+	Delta: [3]int32{2000, 2000, 2000}}
+
+func randBounds(r *rand.Rand) rect.Orthotope {
+	o := rect.Orthotope{}
+	for index := range o.Point {
+		o.Point[index] = r.Int31n(1000)
+		o.Delta[index] = r.Int31n(50) + 1
+	}
+	return o
+}
+
+// Applies count random operations, returning the state after each one and
+// the length of the log after each one.
+func randOps(t *testing.T, j *Journal, r *rand.Rand, count int) ([]state, []int64) {
+	current := state{}
+	for id := range j.orths {
+		current[id], _ = j.Get(id)
+	}
+	states := []state{copyState(current)}
+	lengths := []int64{logLength(t, j)}
+	for i := 0; i < count; i++ {
+		id := uint64(r.Intn(40))
+		var err error
+		switch r.Intn(3) {
+		case 0:
+			current[id] = randBounds(r)
+			err = j.Add(id, current[id])
+		case 1:
+			current[id] = randBounds(r)
+			err = j.Update(id, current[id])
+		default:
+			delete(current, id)
+			err = j.Remove(id)
+		}
+		if err != nil {
+			t.Fatalf("Unable to log operation %d: %v\n", i, err)
+		}
+		states = append(states, copyState(current))
+		lengths = append(lengths, logLength(t, j))
+	}
+	return states, lengths
+}
+
+func copyState(s state) state {
+	c := state{}
+	for id, o := range s {
+		c[id] = o
+	}
+	return c
+}
+
+func logLength(t *testing.T, j *Journal) int64 {
+	return fileSize(t, filepath.Join(j.dir, logName))
+}
+
+func checkState(t *testing.T, j *Journal, expected state) {
+	if j.Len() != len(expected) {
+		t.Errorf("Journal holds %d orthotopes, expected %d\n", j.Len(), len(expected))
+	}
+	for id, o := range expected {
+		if got, ok := j.Get(id); !ok || !got.Equals(&o) {
+			t.Errorf("Journal holds %v for %d, expected %v\n", got.String(), id,
+				o.String())
+		}
+	}
+	count := 0
+	for range j.Query(all) {
+		count++
+	}
+	if count != len(expected) {
+		t.Errorf("Journal query found %d orthotopes, expected %d\n", count,
+			len(expected))
+	}
+}
+
+func copyFile(t *testing.T, from string, to string, length int64) {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v\n", from, err)
+	}
+	if err := os.WriteFile(to, data[:length], 0o644); err != nil {
+		t.Fatalf("Unable to write %s: %v\n", to, err)
+	}
+}
+
+func TestRecoverTruncatedLog(t *testing.T) {
+	r := rand.New(rand.NewSource(45))
+	dir := t.TempDir()
+	j, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to open journal: %v\n", err)
+	}
+	randOps(t, j, r, 50)
+	if err := j.Snapshot(); err != nil {
+		t.Fatalf("Unable to snapshot: %v\n", err)
+	}
+	states, lengths := randOps(t, j, r, 200)
+	j.Close()
+
+	for trial := 0; trial < 50; trial++ {
+		// Crash at a random point in the log.
+		length := r.Int63n(lengths[len(lengths)-1] + 1)
+		crashed := t.TempDir()
+		copyFile(t, filepath.Join(dir, snapshotName),
+			filepath.Join(crashed, snapshotName),
+			fileSize(t, filepath.Join(dir, snapshotName)))
+		copyFile(t, filepath.Join(dir, logName), filepath.Join(crashed, logName),
+			length)
+
+		recovered, err := Open(crashed, Options{})
+		if err != nil {
+			t.Fatalf("Unable to recover from a log of %d bytes: %v\n", length, err)
+		}
+		complete := 0
+		for complete+1 < len(lengths) && lengths[complete+1] <= length {
+			complete++
+		}
+		checkState(t, recovered, states[complete])
+
+		// New operations follow the last complete one.
+		more, _ := randOps(t, recovered, r, 10)
+		recovered.Close()
+		reopened, err := Open(crashed, Options{})
+		if err != nil {
+			t.Fatalf("Unable to reopen: %v\n", err)
+		}
+		checkState(t, reopened, more[len(more)-1])
+		reopened.Close()
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unable to stat %s: %v\n", path, err)
+	}
+	return info.Size()
+}
+
+func TestReplayAfterSnapshot(t *testing.T) {
+	r := rand.New(rand.NewSource(46))
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{Sync: true})
+	states, _ := randOps(t, j, r, 100)
+	stale := filepath.Join(t.TempDir(), logName)
+	copyFile(t, filepath.Join(dir, logName), stale, fileSize(t,
+		filepath.Join(dir, logName)))
+	if err := j.Snapshot(); err != nil {
+		t.Fatalf("Unable to snapshot: %v\n", err)
+	}
+	j.Close()
+
+	// A crash after the snapshot but before emptying the log replays the log
+	// over a snapshot that already holds it.
+	copyFile(t, stale, filepath.Join(dir, logName), fileSize(t, stale))
+	recovered, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to recover: %v\n", err)
+	}
+	checkState(t, recovered, states[len(states)-1])
+	recovered.Close()
+}
+
+func TestSnapshotEvery(t *testing.T) {
+	r := rand.New(rand.NewSource(47))
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{SnapshotEvery: 30})
+	states, lengths := randOps(t, j, r, 100)
+	for _, length := range lengths {
+		if length > 30*int64(addSize) {
+			t.Errorf("Log grew to %d bytes between snapshots\n", length)
+		}
+	}
+	j.Close()
+	recovered, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to recover: %v\n", err)
+	}
+	checkState(t, recovered, states[len(states)-1])
+	recovered.Close()
+}
+
+func TestSnapshotErr(t *testing.T) {
+	r := rand.New(rand.NewSource(51))
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{SnapshotEvery: 5})
+	// A directory in the way of the new snapshot fails it.
+	tmp := filepath.Join(dir, snapshotName+".tmp")
+	os.Mkdir(tmp, 0o755)
+	states, _ := randOps(t, j, r, 5)
+	if j.SnapshotErr() == nil {
+		t.Errorf("Failed snapshot reported no error\n")
+	}
+	checkState(t, j, states[len(states)-1])
+
+	// The next operation retries the snapshot.
+	os.Remove(tmp)
+	if err := j.Remove(0); err != nil {
+		t.Errorf("Unable to log after a failed snapshot: %v\n", err)
+	}
+	if err := j.SnapshotErr(); err != nil || logLength(t, j) != 0 {
+		t.Errorf("Retried snapshot returned %v with %d bytes left in the log\n",
+			err, logLength(t, j))
+	}
+	j.Close()
+	expected := copyState(states[len(states)-1])
+	delete(expected, 0)
+	recovered, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to recover: %v\n", err)
+	}
+	checkState(t, recovered, expected)
+	recovered.Close()
+}
+
+func TestCorruptLog(t *testing.T) {
+	r := rand.New(rand.NewSource(48))
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{})
+	states, lengths := randOps(t, j, r, 20)
+	j.Close()
+
+	// Damage before the last operation is reported, and the log kept for any
+	// operations after it.
+	path := filepath.Join(dir, logName)
+	data, _ := os.ReadFile(path)
+	data[lengths[10]+3] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	if _, err := Open(dir, Options{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Opened a log damaged in the middle with error %v\n", err)
+	}
+	if kept, _ := os.ReadFile(path); !bytes.Equal(kept, data) {
+		t.Errorf("Changed a log damaged in the middle\n")
+	}
+
+	// Damage to the last operation only discards it, as a crash would.
+	data[lengths[10]+3] ^= 0xff
+	data[lengths[19]+3] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	recovered, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to recover: %v\n", err)
+	}
+	checkState(t, recovered, states[19])
+	recovered.Close()
+	if length := fileSize(t, path); length != lengths[19] {
+		t.Errorf("Log of %d bytes after recovery, expected %d\n", length,
+			lengths[19])
+	}
+
+	os.WriteFile(filepath.Join(dir, snapshotName), []byte("corrupt"), 0o644)
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Errorf("Opened a journal with a corrupt snapshot\n")
+	}
+}
+
+// A log that writes only part of a record, or nothing, once failing is set.
+type failingLog struct {
+	*os.File
+	failing  bool
+	torn     int
+	truncate error
+}
+
+func (f *failingLog) Write(data []byte) (int, error) {
+	if !f.failing {
+		return f.File.Write(data)
+	}
+	n, _ := f.File.Write(data[:f.torn])
+	return n, errors.New("disk full")
+}
+
+func (f *failingLog) Truncate(size int64) error {
+	if f.truncate != nil {
+		return f.truncate
+	}
+	return f.File.Truncate(size)
+}
+
+func TestFailedWrite(t *testing.T) {
+	r := rand.New(rand.NewSource(49))
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{})
+	log := &failingLog{File: j.log.(*os.File)}
+	j.log = log
+	states, _ := randOps(t, j, r, 20)
+
+	// A torn write is cut from the log, so later operations survive replay.
+	log.failing, log.torn = true, 5
+	if err := j.Add(100, randBounds(r)); err == nil {
+		t.Errorf("Failed write reported no error\n")
+	}
+	if _, ok := j.Get(100); ok {
+		t.Errorf("Applied an operation that failed to log\n")
+	}
+	log.failing = false
+	checkState(t, j, states[len(states)-1])
+	more, _ := randOps(t, j, r, 10)
+	j.Close()
+	reopened, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to reopen: %v\n", err)
+	}
+	checkState(t, reopened, more[len(more)-1])
+
+	// If the log can not be cut, further operations are rejected until a
+	// snapshot empties it.
+	log = &failingLog{File: reopened.log.(*os.File), failing: true, torn: 5,
+		truncate: errors.New("read only")}
+	reopened.log = log
+	reopened.Remove(0)
+	if err := reopened.Remove(1); !errors.Is(err, ErrBroken) {
+		t.Errorf("Write to a damaged log returned %v\n", err)
+	}
+	log.failing, log.truncate = false, nil
+	if err := reopened.Snapshot(); err != nil {
+		t.Fatalf("Unable to snapshot: %v\n", err)
+	}
+	if err := reopened.Remove(1); err != nil {
+		t.Errorf("Write after repairing the log returned %v\n", err)
+	}
+	expected := copyState(more[len(more)-1])
+	delete(expected, 1)
+	reopened.Close()
+	repaired, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("Unable to reopen: %v\n", err)
+	}
+	checkState(t, repaired, expected)
+	repaired.Close()
+}
+
+func TestMetricOption(t *testing.T) {
+	dir := t.TempDir()
+	j, _ := Open(dir, Options{Metric: rect.AreaMetric{}})
+	randOps(t, j, rand.New(rand.NewSource(50)), 20)
+	j.Snapshot()
+	j.Close()
+	// The decoded snapshot uses the metric as well.
+	reopened, err := Open(dir, Options{Metric: rect.AreaMetric{}})
+	if err != nil {
+		t.Fatalf("Unable to reopen: %v\n", err)
+	}
+	if m := reopened.BVol().Metric(); m != (rect.AreaMetric{}) {
+		t.Errorf("Journal hierarchy uses %T, expected rect.AreaMetric\n", m)
+	}
+	reopened.Close()
+}
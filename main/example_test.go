@@ -43,4 +43,11 @@ func TestExample(t *testing.T) {
 		t.Logf("Orthtope: %d @%p w/ Distance: %d", r, r, d)
 	}
 
+	// Range over a BVol for queries that keep their own state; no Reset needed.
+	for r := range bvol.Query(q) {
+		t.Logf("Orthtope: %d @%p", r, r)
+	}
+	for r, d := range bvol.Trace(q) {
+		t.Logf("Orthtope: %d @%p w/ Distance: %d", r, r, d)
+	}
 }
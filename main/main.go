@@ -9,6 +9,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/briannoyama/bvh/rect"
@@ -19,7 +20,21 @@ func main() {
 		"JSON configuration for the test.")
 	compare := flag.Bool("compare", false,
 		"Compare with Top Down method? Default False.")
+	metric := flag.String("metric", "score",
+		"Cost metric: score, area, volume or overlap. Default score.")
+	validate := flag.Bool("validate", false,
+		"Validate the hierarchy after each change? Default False.")
+	stats := flag.String("stats", "",
+		"Print statistics for the hierarchy in this file, JSON if it ends in .json.")
 	flag.Parse()
+	if *stats != "" {
+		printStats(*stats, *validate)
+		return
+	}
+	m, ok := metrics[*metric]
+	if !ok {
+		log.Fatalf("Unknown metric: %v", *metric)
+	}
 	configFile, err := os.Open(*config)
 	if err != nil {
 		fmt.Println(err)
@@ -29,7 +44,7 @@ func main() {
 
 	configBytes, _ := ioutil.ReadAll(configFile)
 
-	test := &bvhTest{}
+	test := &bvhTest{metric: m, validate: *validate}
 	json.Unmarshal([]byte(configBytes), test)
 	if *compare {
 		test.comparisonTest()
@@ -38,6 +53,38 @@ func main() {
 	}
 }
 
+// Prints statistics for a hierarchy written by Encode or EncodeJSON.
+func printStats(path string, validate bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	var bvol *rect.BVol
+	if strings.HasSuffix(path, ".json") {
+		bvol, err = rect.DecodeJSON(file, nil)
+	} else {
+		bvol, err = rect.Decode(file, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if validate {
+		if err := bvol.Validate(); err != nil {
+			log.Fatalf("Invalid hierarchy in %s:\n%v", path, err)
+		}
+	}
+	fmt.Print(bvol.Stats().String())
+}
+
+var metrics = map[string]rect.Metric{
+	"score":   rect.ScoreMetric{},
+	"area":    rect.AreaMetric{},
+	"volume":  rect.VolumeMetric{},
+	"overlap": rect.OverlapMetric{},
+}
+
 type operation struct {
 	orth   *rect.Orthotope
 	opcode int
@@ -51,6 +98,18 @@ type bvhTest struct {
 	Removals  int
 	Queries   int
 	RandSeed  int64
+	metric    rect.Metric
+	validate  bool
+}
+
+// Stops the test if validation is on and the hierarchy is broken.
+func (b *bvhTest) check(bvol *rect.BVol, op string) {
+	if !b.validate {
+		return
+	}
+	if err := bvol.Validate(); err != nil {
+		log.Fatalf("Invalid hierarchy after %s:\n%v", op, err)
+	}
 }
 
 func (b *bvhTest) comparisonTest() {
@@ -58,12 +117,16 @@ func (b *bvhTest) comparisonTest() {
 	r := rand.New(rand.NewSource(b.RandSeed))
 	bvol := &rect.BVol{}
 	iter := bvol.Iterator()
+	iter.SetMetric(b.metric)
+	builder := rect.Builder{Metric: b.metric}
 	for a := 0; a < b.Additions; a += 1 {
 		orth := b.makeOrth(r)
 		orths = append(orths, orth)
 
 		iter.Add(orth)
-		bvol2 := rect.TopDownBVH(orths)
+		b.check(bvol, "add")
+		bvol2 := builder.TopDown(orths)
+		b.check(bvol2, "top down build")
 
 		fmt.Printf("%d, %d, %d, %d, %d\n", a, bvol.GetDepth(), iter.Score(),
 			bvol2.GetDepth(), bvol2.Score())
@@ -75,6 +138,7 @@ func (b *bvhTest) runTest() {
 	removed := make(map[int]bool, b.Additions)
 	bvol := &rect.BVol{}
 	iter := bvol.Iterator()
+	iter.SetMetric(b.metric)
 	r := rand.New(rand.NewSource(b.RandSeed))
 
 	if b.Removals > b.Additions {
@@ -96,6 +160,7 @@ func (b *bvhTest) runTest() {
 		duration := time.Now().Sub(t).Nanoseconds()
 		total += 1
 		fmt.Printf("add, %d, %d, %d\n", total, bvol.GetDepth(), duration)
+		b.check(bvol, "add")
 
 		for removal := 0; removal < removals[a]; removal += 1 {
 			toRemove := r.Intn(a + 1)
@@ -110,6 +175,7 @@ func (b *bvhTest) runTest() {
 				duration := time.Now().Sub(t).Nanoseconds()
 				total -= 1
 				fmt.Printf("sub, %d, %d, %d\n", total, bvol.GetDepth(), duration)
+				b.check(bvol, "sub")
 			} else if a+1 < len(removals) {
 				removals[a+1] += 1
 			}
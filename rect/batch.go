@@ -0,0 +1,65 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A Hit is an orthotope intersected by a traced vector and its distance.
+type Hit struct {
+	Orth     *Orthotope
+	Distance int32
+}
+
+// QueryBatch runs every query across up to workers goroutines, each with its
+// own iterator. The results for queries[i] are returned at index i. A workers
+// value less than 1 uses GOMAXPROCS goroutines.
+func (bvol *BVol) QueryBatch(queries []*Orthotope, workers int) [][]*Orthotope {
+	results := make([][]*Orthotope, len(queries))
+	bvol.batch(len(queries), workers, func(s *orthStack, i int) {
+		s.query(queries[i], func(r *Orthotope) bool {
+			results[i] = append(results[i], r)
+			return true
+		})
+	})
+	return results
+}
+
+// TraceBatch traces every vector across up to workers goroutines, each with
+// its own iterator. The hits for rays[i] are returned at index i in the order
+// Trace finds them. A workers value less than 1 uses GOMAXPROCS goroutines.
+func (bvol *BVol) TraceBatch(rays []*Orthotope, workers int) [][]Hit {
+	results := make([][]Hit, len(rays))
+	bvol.batch(len(rays), workers, func(s *orthStack, i int) {
+		s.trace(rays[i], func(r *Orthotope, distance int32) bool {
+			results[i] = append(results[i], Hit{Orth: r, Distance: distance})
+			return true
+		})
+	})
+	return results
+}
+
+// Calls work for each index below n, sharing the indices between workers.
+func (bvol *BVol) batch(n int, workers int, work func(s *orthStack, i int)) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	var next atomic.Int64
+	var wait sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			s := bvol.Iterator()
+			for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+				work(s, i)
+			}
+		}()
+	}
+	wait.Wait()
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryBatch(t *testing.T) {
+	tree := TopDownBVH(randOrths(4, 2000))
+	queries := randOrths(5, 300)
+
+	for _, workers := range []int{0, 1, 3} {
+		results := tree.QueryBatch(queries, workers)
+		if len(results) != len(queries) {
+			t.Fatalf("Expected %d results, got %d\n", len(queries), len(results))
+		}
+		for i, q := range queries {
+			expected := 0
+			for range tree.Query(q) {
+				expected++
+			}
+			if len(results[i]) != expected {
+				t.Errorf("Batch query %v returned %d values, expected %d\n",
+					q.String(), len(results[i]), expected)
+			}
+			for _, r := range results[i] {
+				if !r.Overlaps(q) {
+					t.Errorf("Batch query %v returned %v\n", q.String(), r.String())
+				}
+			}
+		}
+	}
+
+	if results := (&BVol{}).QueryBatch(queries, 2); len(results[0]) != 0 {
+		t.Errorf("Querying an empty hierarchy returned %v\n", results[0])
+	}
+}
+
+func TestTraceBatch(t *testing.T) {
+	tree := getIdealTree()
+	rays := []*Orthotope{
+		{Point: [d]int32{-2, 0}, Delta: [d]int32{4, 2}},
+		{Point: [d]int32{14, 11}, Delta: [d]int32{-1, 0}},
+		{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}},
+		{Point: [d]int32{0, 40}, Delta: [d]int32{5, -1}},
+	}
+	expected := [][]*Orthotope{
+		{leaf[0], leaf[3]},
+		{leaf[4]},
+		{leaf[7], leaf[3], leaf[2]},
+		{},
+	}
+
+	results := tree.TraceBatch(rays, 2)
+	for i, hits := range results {
+		if len(hits) != len(expected[i]) {
+			t.Errorf("Batch trace %v returned %v, expected %v\n", rays[i].String(),
+				hits, expected[i])
+			continue
+		}
+		for j, hit := range hits {
+			if hit.Orth != expected[i][j] {
+				t.Errorf("Batch trace %v returned %v out of order\n", rays[i].String(),
+					hit.Orth.String())
+			}
+		}
+	}
+}
+
+func BenchmarkQueryBatch(b *testing.B) {
+	tree := TopDownBVH(randOrths(6, 20000))
+	queries := randOrths(7, 4000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				tree.QueryBatch(queries, workers)
+			}
+		})
+	}
+}
+
+func BenchmarkTraceBatch(b *testing.B) {
+	tree := TopDownBVH(randOrths(8, 20000))
+	rays := randOrths(9, 500)
+	for _, ray := range rays {
+		ray.Delta[1] = -ray.Delta[1]
+	}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				tree.TraceBatch(rays, workers)
+			}
+		})
+	}
+}
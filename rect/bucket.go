@@ -0,0 +1,211 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"iter"
+	"math"
+	"sort"
+)
+
+// A BucketBVol holds up to a fixed number of orthotopes in each leaf, which
+// queries scan linearly. Fewer, fuller leaves suit dense static scenes. Each
+// leaf of the inner BVol is the bounding volume of a bucket.
+type BucketBVol struct {
+	bvol    *BVol
+	iter    *orthStack
+	maxLeaf int
+	// The bucket for each leaf of the inner BVol and for each orthotope held.
+	buckets map[*Orthotope]*bucket
+	owners  map[*Orthotope]*bucket
+}
+
+type bucket struct {
+	bounds Orthotope
+	orths  []*Orthotope
+}
+
+// NewBucketBVol creates an empty hierarchy with up to maxLeaf orthotopes in
+// each leaf.
+func NewBucketBVol(maxLeaf int) *BucketBVol {
+	bvol := &BVol{}
+	return &BucketBVol{bvol: bvol, iter: bvol.Iterator(), maxLeaf: max(maxLeaf, 1),
+		buckets: map[*Orthotope]*bucket{}, owners: map[*Orthotope]*bucket{}}
+}
+
+// Buckets builds a hierarchy with up to maxLeaf orthotopes in each leaf, by
+// halving orths until they fit in buckets, then building the buckets top down.
+func (b Builder) Buckets(orths []*Orthotope, maxLeaf int) *BucketBVol {
+	bb := NewBucketBVol(maxLeaf)
+	bounds := []*Orthotope{}
+	var fill func(orths []*Orthotope)
+	fill = func(orths []*Orthotope) {
+		if len(orths) > bb.maxLeaf {
+			first, second := halve(orths)
+			fill(first)
+			fill(second)
+			return
+		}
+		bounds = append(bounds, &bb.newBucket(orths...).bounds)
+	}
+	if len(orths) > 0 {
+		fill(append([]*Orthotope(nil), orths...))
+	}
+	*bb.bvol = *b.TopDown(bounds)
+	return bb
+}
+
+// Creates a bucket holding orths and records it, without adding it to the BVol.
+func (bb *BucketBVol) newBucket(orths ...*Orthotope) *bucket {
+	b := &bucket{orths: append(make([]*Orthotope, 0, bb.maxLeaf), orths...)}
+	b.bounds.MinBounds(b.orths...)
+	bb.buckets[&b.bounds] = b
+	for _, orth := range orths {
+		bb.owners[orth] = b
+	}
+	return b
+}
+
+// Halves orthotopes, sorted as byDimension sorts them, along the dimension in
+// which their points are most spread out.
+func halve(orths []*Orthotope) ([]*Orthotope, []*Orthotope) {
+	low := orths[0].Point
+	high := orths[0].Point
+	for _, orth := range orths[1:] {
+		for index, p := range orth.Point {
+			low[index] = min(low[index], p)
+			high[index] = max(high[index], p)
+		}
+	}
+	widest := 0
+	for index := range low {
+		if high[index]-low[index] > high[widest]-low[widest] {
+			widest = index
+		}
+	}
+	sort.Sort(byDimension{orths: orths, dimension: widest})
+	mid := len(orths) / 2
+	return orths[:mid], orths[mid:]
+}
+
+// Len returns the number of orthotopes in the hierarchy.
+func (bb *BucketBVol) Len() int {
+	return len(bb.owners)
+}
+
+// Contains checks whether the orthotope is in the hierarchy.
+func (bb *BucketBVol) Contains(orth *Orthotope) bool {
+	return bb.owners[orth] != nil
+}
+
+// Add an orthotope to the bucket it enlarges least. A full bucket is split in
+// two, which are added to the inner BVol in its place.
+func (bb *BucketBVol) Add(orth *Orthotope) bool {
+	if bb.owners[orth] != nil {
+		return false
+	}
+	if bb.bvol.vol == nil {
+		bb.iter.Add(&bb.newBucket(orth).bounds)
+		return true
+	}
+
+	// Descend to the bucket that grows the least.
+	m := bb.iter.Metric()
+	path := []*BVol{}
+	next := bb.bvol
+	for next.depth > 0 {
+		path = append(path, next)
+		lowIndex := 0
+		smallestScore := int64(math.MaxInt64)
+		for index, vol := range next.desc {
+			score := m.Enlargement(vol.vol, next.desc[index^1].vol, orth)
+			if score < smallestScore {
+				lowIndex = index
+				smallestScore = score
+			}
+		}
+		next = next.desc[lowIndex]
+	}
+
+	b := bb.buckets[next.vol]
+	if len(b.orths) < bb.maxLeaf {
+		b.orths = append(b.orths, orth)
+		bb.owners[orth] = b
+		b.bounds.MinBounds(&b.bounds, orth)
+		*next.added = b.bounds
+		for i := len(path) - 1; i >= 0; i-- {
+			path[i].minBound()
+		}
+		return true
+	}
+
+	// Split the full bucket.
+	bb.iter.Remove(&b.bounds)
+	delete(bb.buckets, &b.bounds)
+	first, second := halve(append(b.orths, orth))
+	bb.iter.Add(&bb.newBucket(first...).bounds)
+	bb.iter.Add(&bb.newBucket(second...).bounds)
+	return true
+}
+
+// Remove an orthotope from its bucket, removing the bucket once empty.
+func (bb *BucketBVol) Remove(orth *Orthotope) bool {
+	b := bb.owners[orth]
+	if b == nil {
+		return false
+	}
+	delete(bb.owners, orth)
+	if len(b.orths) == 1 {
+		bb.iter.Remove(&b.bounds)
+		delete(bb.buckets, &b.bounds)
+		return true
+	}
+	for index, other := range b.orths {
+		if other == orth {
+			last := len(b.orths) - 1
+			b.orths[index] = b.orths[last]
+			b.orths[last] = nil
+			b.orths = b.orths[:last]
+			break
+		}
+	}
+
+	// Find the bucket by its old bounds before shrinking them.
+	s := bb.iter
+	s.Reset()
+	s.path(&b.bounds, false)
+	b.bounds.MinBounds(b.orths...)
+	*s.bvStack[len(s.bvStack)-1].added = b.bounds
+	for index := len(s.bvStack) - 2; index >= 0; index-- {
+		s.bvStack[index].minBound()
+	}
+	return true
+}
+
+// Query returns a sequence of the orthotopes that overlap o.
+func (bb *BucketBVol) Query(o *Orthotope) iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		for bounds := range bb.bvol.Query(o) {
+			for _, orth := range bb.buckets[bounds].orths {
+				if orth.Overlaps(o) && !yield(orth) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Trace returns a sequence of the orthotopes intersected by the vector o along
+// with their distances. Buckets are visited nearest branches first, but the
+// orthotopes in a bucket are returned in no particular order.
+func (bb *BucketBVol) Trace(o *Orthotope) iter.Seq2[*Orthotope, int32] {
+	return func(yield func(*Orthotope, int32) bool) {
+		for bounds := range bb.bvol.Trace(o) {
+			for _, orth := range bb.buckets[bounds].orths {
+				if distance := o.Intersects(orth); distance >= 0 &&
+					!yield(orth, distance) {
+					return
+				}
+			}
+		}
+	}
+}
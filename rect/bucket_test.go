@@ -0,0 +1,95 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+// Checks that each bucket bounds its orthotopes and holds no more than allowed.
+func checkBuckets(t *testing.T, bb *BucketBVol, n int) {
+	checkTree(t, bb.bvol)
+	if bb.Len() != n {
+		t.Errorf("Bucket hierarchy holds %d orthotopes, expected %d\n", bb.Len(), n)
+	}
+	for bounds := range bb.bvol.Leaves() {
+		b := bb.buckets[bounds]
+		if b == nil || len(b.orths) == 0 || len(b.orths) > bb.maxLeaf {
+			t.Errorf("Leaf %v has an empty, oversized or unknown bucket\n",
+				bounds.String())
+			continue
+		}
+		for _, orth := range b.orths {
+			if !bounds.Contains(orth) || bb.owners[orth] != b {
+				t.Errorf("Bucket %v does not hold %v\n", bounds.String(),
+					orth.String())
+			}
+		}
+	}
+}
+
+func TestBucketAddRemove(t *testing.T) {
+	orths := randOrths(38, 500)
+	bb := NewBucketBVol(4)
+	for index, orth := range orths {
+		if !bb.Add(orth) {
+			t.Errorf("Unable to add %v\n", orth.String())
+		}
+		if index%50 == 0 {
+			checkBuckets(t, bb, index+1)
+		}
+	}
+	if bb.Add(orths[0]) {
+		t.Errorf("Added %v twice\n", orths[0].String())
+	}
+	checkBuckets(t, bb, len(orths))
+
+	bvol := TopDownBVH(orths)
+	all := &Orthotope{Point: [d]int32{-1, -1, -1}, Delta: [d]int32{1200, 1200, 1200}}
+	q := &Orthotope{Point: [d]int32{200, 300, 400}, Delta: [d]int32{300, 200, 100}}
+	for _, o := range []*Orthotope{all, q} {
+		if !sameSet(collect(bb.Query(o)), collect(bvol.Query(o))) {
+			t.Errorf("Bucket query %v differs from the binary tree\n", o.String())
+		}
+	}
+
+	for _, orth := range orths[:400] {
+		if !bb.Remove(orth) {
+			t.Errorf("Unable to remove %v\n", orth.String())
+		}
+	}
+	if bb.Remove(orths[0]) {
+		t.Errorf("Removed %v twice\n", orths[0].String())
+	}
+	checkBuckets(t, bb, 100)
+	for _, orth := range orths[400:] {
+		bb.Remove(orth)
+	}
+	if bb.Len() != 0 || bb.bvol.vol != nil || len(bb.buckets) != 0 {
+		t.Errorf("Bucket hierarchy is not empty after removing everything\n")
+	}
+}
+
+func TestBucketBuild(t *testing.T) {
+	orths := randOrths(83, 1000)
+	bb := Builder{}.Buckets(orths, 8)
+	checkBuckets(t, bb, len(orths))
+	if leaves := len(bb.buckets); leaves > len(orths)/4 {
+		t.Errorf("Built %d buckets for %d orthotopes\n", leaves, len(orths))
+	}
+
+	bvol := TopDownBVH(orths)
+	rays := []*Orthotope{
+		{Point: [d]int32{-10, 500, 500}, Delta: [d]int32{7, 1, -1}},
+		{Point: [d]int32{1000, 0, 20}, Delta: [d]int32{-5, 4, 3}},
+	}
+	for _, ray := range rays {
+		if !sameSet(collectTrace(t, ray, bb.Trace(ray)),
+			collectTrace(t, ray, bvol.Trace(ray))) {
+			t.Errorf("Bucket trace %v differs from the binary tree\n", ray.String())
+		}
+	}
+
+	if (Builder{}).Buckets(nil, 8).Len() != 0 {
+		t.Errorf("Building from no orthotopes is not empty\n")
+	}
+}
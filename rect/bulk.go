@@ -0,0 +1,257 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"math"
+
+	disc "github.com/briannoyama/bvh/discreet"
+)
+
+// AddAll adds a batch of orthotopes to the hierarchy by building them into
+// their own hierarchy and merging it in, rebalancing once. With BRANCH_AND_BOUND
+// insertion, each orthotope is instead added on its own, to find its best
+// sibling. The orthotopes must not already be in the hierarchy.
+func (bvol *BVol) AddAll(orths []*Orthotope) {
+	bvol.updater().AddAll(orths)
+}
+
+// RemoveAll removes a batch of orthotopes in one pass over the hierarchy and
+// returns how many were found.
+func (bvol *BVol) RemoveAll(orths []*Orthotope) int {
+	return bvol.updater().RemoveAll(orths)
+}
+
+// Merge moves every volume of other into the hierarchy, rebalancing once. The
+// volumes of other must not already be in the hierarchy. Other is left empty.
+func (bvol *BVol) Merge(other *BVol) {
+	bvol.updater().Merge(other)
+}
+
+// Extract removes every orthotope that lies within region and returns them as
+// a hierarchy of their own. Volumes that lie entirely within (or outside) the
+// region are moved whole rather than leaf by leaf. The new hierarchy uses the
+// same metric.
+func (bvol *BVol) Extract(region *Orthotope) *BVol {
+	return bvol.updater().Extract(region)
+}
+
+// AddAll adds a batch of orthotopes to the BVH associated with this stack.
+func (s *orthStack) AddAll(orths []*Orthotope) {
+	if len(orths) == 0 {
+		return
+	}
+	if s.bvh.Insertion() == BRANCH_AND_BOUND {
+		for _, orth := range orths {
+			s.Add(orth)
+		}
+		return
+	}
+	// Build on a copy, since building sorts the orthotopes.
+	s.merge(topDown(append([]*Orthotope(nil), orths...), 1, s.Metric()))
+}
+
+// RemoveAll removes a batch of orthotopes from the BVH associated with this stack.
+func (s *orthStack) RemoveAll(orths []*Orthotope) int {
+	if s.bvh.vol == nil || len(orths) == 0 {
+		return 0
+	}
+	remove := make(map[*Orthotope]bool, len(orths))
+	for _, orth := range orths {
+		remove[orth] = true
+	}
+	kept, removed := s.prune(s.moveRoot(), orths, remove)
+	s.setRoot(kept)
+	return removed
+}
+
+// Merge moves every volume of other into the BVH associated with this stack.
+func (s *orthStack) Merge(other *BVol) {
+	// Move the root out of other, so that other can no longer reach the volumes.
+	node := s.newNode(nil)
+	node.replace(other)
+	other.replace(nil)
+	s.merge(node)
+}
+
+// Extract removes the orthotopes within region from the BVH associated with
+// this stack and returns them as a new hierarchy.
+func (s *orthStack) Extract(region *Orthotope) *BVol {
+	extracted := &BVol{tree: s.bvh.tree.settings()}
+	if s.bvh.vol == nil {
+		return extracted
+	}
+	kept, taken := s.split(s.moveRoot(), region)
+	s.setRoot(kept)
+	if taken != nil {
+		extracted.replace(taken)
+		s.freeNode(taken)
+	}
+	return extracted
+}
+
+// Merges the other hierarchy into the BVH associated with this stack.
+func (s *orthStack) merge(other *BVol) {
+	if other.vol == nil {
+		return
+	}
+	if s.bvh.vol == nil {
+		s.setRoot(other)
+		return
+	}
+	s.setRoot(s.join(s.moveRoot(), other))
+}
+
+// Moves the contents of the root into a volume of its own, so that the root
+// can take on whichever volume results from rearranging the hierarchy.
+func (s *orthStack) moveRoot() *BVol {
+	node := s.newNode(nil)
+	node.replace(s.bvh)
+	return node
+}
+
+// Moves the contents of node, which is then freed, into the root, or empties
+// the root when node is nil.
+func (s *orthStack) setRoot(node *BVol) {
+	s.bvh.replace(node)
+	if node != nil {
+		s.freeNode(node)
+	}
+}
+
+// Replaces the contents of a root volume with those of node, or empties it
+// when node is nil. The root keeps its own state.
+func (bvol *BVol) replace(node *BVol) {
+	bvol.changed()
+	t := bvol.tree
+	if node == nil {
+		*bvol = BVol{}
+	} else {
+		*bvol = *node
+	}
+	bvol.tree = t
+}
+
+// Combines two balanced hierarchies into one. When their depths differ by more
+// than one, the shallower is joined into the child of the deeper that it
+// enlarges least, and the deeper is rebalanced on the way back up.
+func (s *orthStack) join(first *BVol, second *BVol) *BVol {
+	if first == nil {
+		return second
+	} else if second == nil {
+		return first
+	}
+	if first.depth < second.depth {
+		first, second = second, first
+	}
+	if first.depth <= second.depth+1 {
+		bvol := s.newNode(s.newVol())
+		bvol.desc = [2]*BVol{first, second}
+		bvol.redepth()
+		bvol.minBound()
+		return bvol
+	}
+
+	m := s.Metric()
+	lowIndex := 0
+	smallestScore := int64(math.MaxInt64)
+	for index, child := range first.desc {
+		score := m.Enlargement(child.vol, first.desc[index^1].vol, second.vol)
+		if score < smallestScore {
+			lowIndex = index
+			smallestScore = score
+		}
+	}
+	first.desc[lowIndex] = s.join(first.desc[lowIndex], second)
+	first.rebalance(m)
+	return first
+}
+
+// Restores balance when the children of a volume differ in depth by two, by
+// swapping the shallower child with the deeper grandchild. Then redistributes.
+func (bvol *BVol) rebalance(m Metric) {
+	for index, tall := range bvol.desc {
+		short := bvol.desc[index^1]
+		if tall.depth > short.depth+1 {
+			deep := 0
+			if tall.desc[1].depth > tall.desc[0].depth {
+				deep = 1
+			}
+			tall.desc[deep], bvol.desc[index^1] = short, tall.desc[deep]
+			tall.redepth()
+			tall.minBound()
+			break
+		}
+	}
+	bvol.redistribute(m)
+	bvol.minBound()
+}
+
+// Removes the leaves in remove, only descending into volumes that contain one
+// of orths. Returns what remains of the hierarchy, or nil, along with the
+// number of leaves removed.
+func (s *orthStack) prune(bvol *BVol, orths []*Orthotope,
+	remove map[*Orthotope]bool) (*BVol, int) {
+	if bvol.depth == 0 {
+		if remove[bvol.vol] {
+			s.freeVol(bvol.added)
+			s.freeNode(bvol)
+			return nil, 1
+		}
+		return bvol, 0
+	}
+
+	removed := 0
+	var desc [2]*BVol
+	for index, child := range bvol.desc {
+		inside := []*Orthotope{}
+		for _, orth := range orths {
+			if child.vol.Contains(orth) {
+				inside = append(inside, orth)
+			}
+		}
+		desc[index] = child
+		if len(inside) > 0 {
+			var count int
+			desc[index], count = s.prune(child, inside, remove)
+			removed += count
+		}
+	}
+
+	if removed == 0 {
+		return bvol, 0
+	}
+	return s.rejoin(bvol, desc[0], desc[1]), removed
+}
+
+// Splits the hierarchy into the leaves outside of region and those within it,
+// either of which may be nil.
+func (s *orthStack) split(bvol *BVol, region *Orthotope) (*BVol, *BVol) {
+	if region.Contains(bvol.vol) {
+		return nil, bvol
+	} else if bvol.depth == 0 || !region.Overlaps(bvol.vol) {
+		return bvol, nil
+	}
+	out0, in0 := s.split(bvol.desc[0], region)
+	out1, in1 := s.split(bvol.desc[1], region)
+
+	if in0 == nil && in1 == nil {
+		return bvol, nil
+	} else if out0 == nil && out1 == nil {
+		return nil, s.rejoin(bvol, in0, in1)
+	}
+	return s.rejoin(bvol, out0, out1), s.join(in0, in1)
+}
+
+// Replaces the children of a volume, either of which may be nil, and returns
+// the rebalanced volume or what remains of it.
+func (s *orthStack) rejoin(bvol *BVol, first *BVol, second *BVol) *BVol {
+	if first == nil || second == nil || disc.Abs(first.depth-second.depth) > 2 {
+		// Too unbalanced to rotate, so join the remaining children instead.
+		s.freeVol(bvol.vol)
+		s.freeNode(bvol)
+		return s.join(first, second)
+	}
+	bvol.desc = [2]*BVol{first, second}
+	bvol.rebalance(s.Metric())
+	return bvol
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+// Checks depths, balance and bounds of every volume in the hierarchy.
+func checkTree(t *testing.T, bvol *BVol) {
+	t.Helper()
+	for n := range bvol.Nodes() {
+		if n.depth == 0 {
+			if n.vol != nil && n.added == nil {
+				t.Errorf("Leaf keeps no copy of %v\n", n.vol.String())
+			}
+			continue
+		}
+		if n.added != nil {
+			t.Errorf("Internal volume keeps a copy of its bounds:\n%v", n.String())
+		}
+		if n.depth != max(n.desc[0].depth, n.desc[1].depth)+1 {
+			t.Errorf("Stale depth %d at:\n%v", n.depth, n.String())
+		}
+		if n.count != n.desc[0].leaves()+n.desc[1].leaves() {
+			t.Errorf("Stale count %d at:\n%v", n.count, n.String())
+		}
+		if n.desc[0].depth-n.desc[1].depth > 1 || n.desc[1].depth-n.desc[0].depth > 1 {
+			t.Errorf("Unbalanced volume:\n%v", n.String())
+		}
+		if !n.vol.Contains(n.desc[0].vol) || !n.vol.Contains(n.desc[1].vol) {
+			t.Errorf("Volume does not contain its children:\n%v", n.String())
+		}
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	for _, size := range []int{1, 3, 40, 700} {
+		tree := getIdealTree()
+		orths := randOrths(int64(size), size)
+		tree.AddAll(orths)
+		checkTree(t, tree)
+
+		iter := tree.Iterator()
+		for _, orth := range append(orths, leaf[:]...) {
+			if !iter.Contains(orth) {
+				t.Errorf("Unable to find: %v\n", orth.String())
+			}
+		}
+	}
+
+	tree := &BVol{}
+	tree.AddAll(leaf[:])
+	tree.AddAll(nil)
+	if tree.Score() != TopDownBVH(append([]*Orthotope{}, leaf[:]...)).Score() {
+		t.Errorf("Adding to an empty hierarchy should build top down:\n%v", tree.String())
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	orths := randOrths(12, 1000)
+	tree := &BVol{}
+	for _, orth := range orths[:500] {
+		tree.Add(orth)
+	}
+	tree.AddAll(orths[500:])
+
+	// Remove a contiguous run, which tends to empty whole subtrees, and a spread.
+	toRemove := append([]*Orthotope{}, orths[100:400]...)
+	for i := 500; i < 1000; i += 3 {
+		toRemove = append(toRemove, orths[i])
+	}
+	missing := &Orthotope{Point: [d]int32{1, 1, 1}, Delta: [d]int32{1, 1, 1}}
+	if removed := tree.RemoveAll(append(toRemove, missing)); removed != len(toRemove) {
+		t.Errorf("Removed %d volumes, expected %d\n", removed, len(toRemove))
+	}
+	checkTree(t, tree)
+
+	removed := map[*Orthotope]bool{}
+	for _, orth := range toRemove {
+		removed[orth] = true
+	}
+	iter := tree.Iterator()
+	for _, orth := range orths {
+		if iter.Contains(orth) == removed[orth] {
+			t.Errorf("Unexpected membership for %v\n", orth.String())
+		}
+	}
+
+	tree = getIdealTree()
+	if removed := tree.RemoveAll(leaf[:]); removed != len(leaf) || tree.vol != nil {
+		t.Errorf("Expected an empty hierarchy after removing %d volumes\n", removed)
+	}
+}
+
+// Random orthotopes within a chunk of the world along the first dimension.
+func chunkOrths(seed int64, chunk int32, n int) []*Orthotope {
+	orths := randOrths(seed, n)
+	for _, orth := range orths {
+		orth.Point[0] = chunk*2000 + orth.Point[0]
+	}
+	return orths
+}
+
+func TestMergeExtract(t *testing.T) {
+	world := &BVol{}
+	chunks := [][]*Orthotope{}
+	for chunk := int32(0); chunk < 4; chunk++ {
+		orths := chunkOrths(int64(chunk), chunk, 100*int(chunk+1))
+		chunks = append(chunks, orths)
+		prebuilt := TopDownBVH(append([]*Orthotope{}, orths...))
+		world.Merge(prebuilt)
+		if prebuilt.vol != nil {
+			t.Errorf("Merged hierarchy was not emptied:\n%v", prebuilt.String())
+		}
+		checkTree(t, world)
+	}
+
+	region := &Orthotope{Point: [d]int32{4000, 0, 0}, Delta: [d]int32{1999, 2000, 2000}}
+	extracted := world.Extract(region)
+	checkTree(t, world)
+	checkTree(t, extracted)
+
+	iter := world.Iterator()
+	extractedIter := extracted.Iterator()
+	for chunk, orths := range chunks {
+		for _, orth := range orths {
+			if iter.Contains(orth) == (chunk == 2) {
+				t.Errorf("Unexpected membership in world for %v\n", orth.String())
+			}
+			if extractedIter.Contains(orth) != (chunk == 2) {
+				t.Errorf("Unexpected membership in extract for %v\n", orth.String())
+			}
+		}
+	}
+
+	// Reattach the chunk, then extract everything.
+	world.Merge(extracted)
+	checkTree(t, world)
+	everything := &Orthotope{Point: [d]int32{0, 0, 0}, Delta: [d]int32{10000, 2000, 2000}}
+	all := world.Extract(everything)
+	if world.vol != nil {
+		t.Errorf("Expected an empty hierarchy, got:\n%v", world.String())
+	}
+	if empty := world.Extract(everything); empty.vol != nil {
+		t.Errorf("Extracting from an empty hierarchy returned:\n%v", empty.String())
+	}
+	count := 0
+	for range all.Leaves() {
+		count++
+	}
+	if count != 1000 {
+		t.Errorf("Extracted %d volumes, expected 1000\n", count)
+	}
+}
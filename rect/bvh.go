@@ -5,6 +5,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"sync"
 
 	disc "github.com/briannoyama/bvh/discreet"
 )
@@ -14,6 +15,15 @@ type BVol struct {
 	vol   *Orthotope
 	desc  [2]*BVol
 	depth int32
+	// The number of leaves below an internal volume, kept by redepth. Leaves
+	// ignore it and count as one.
+	count int32
+	// A copy of a leaf's orthotope as it was added, to detect changes made in
+	// place. Nil for internal volumes.
+	added *Orthotope
+	// State shared by the iterators of the hierarchy. Only the root has one,
+	// from its first update.
+	tree *tree
 }
 
 func (bvol *BVol) minBound() {
@@ -22,8 +32,36 @@ func (bvol *BVol) minBound() {
 	}
 }
 
+// Copies the volume so that it may be modified without affecting other trees.
+// Leaves share their orthotope, which the hierarchy never modifies. A copy of
+// a root starts a hierarchy of its own, so it shares no state.
+func (bvol *BVol) copyNode() *BVol {
+	node := *bvol
+	node.tree = nil
+	if node.depth > 0 {
+		vol := *node.vol
+		node.vol = &vol
+	}
+	return &node
+}
+
+// Returns whether the orthotope of a leaf was modified in place since it was
+// added.
+func (bvol *BVol) mutated() bool {
+	return bvol.added == nil || !bvol.added.Equals(bvol.vol)
+}
+
 func (bvol *BVol) redepth() {
 	bvol.depth = disc.Max(bvol.desc[0].depth, bvol.desc[1].depth) + 1
+	bvol.count = bvol.desc[0].leaves() + bvol.desc[1].leaves()
+}
+
+// Returns the number of leaves in a non-empty volume.
+func (bvol *BVol) leaves() int32 {
+	if bvol.depth == 0 {
+		return 1
+	}
+	return bvol.count
 }
 
 type byDimension struct {
@@ -47,22 +85,66 @@ func (d byDimension) Less(i, j int) bool {
 			d.orths[j].Delta[d.dimension])
 }
 
+// Sub-hierarchies smaller than this are not worth building on a new goroutine.
+const parallelMin = 1024
+
+// A Builder creates hierarchies from a known set of orthotopes.
+type Builder struct {
+	// Workers bounds the goroutines used to build the upper levels of the
+	// hierarchy. Values less than 2 build on the calling goroutine.
+	Workers int
+	// Metric chooses where to split the orthotopes, and is kept by the
+	// hierarchy for later additions. Defaults to ScoreMetric.
+	Metric Metric
+	// Insertion is kept by the hierarchy for later additions. Defaults to GREEDY.
+	Insertion Insertion
+}
+
 // Creates a balanced BVH by recursively halving, sorting and comparing vols.
 func TopDownBVH(orths []*Orthotope) *BVol {
+	return Builder{}.TopDown(orths)
+}
+
+// TopDown creates the same hierarchy as TopDownBVH, building the two halves
+// of the upper levels on separate goroutines. Since each goroutine only sorts
+// its own half of orths, the result depends only on the order of orths.
+func (b Builder) TopDown(orths []*Orthotope) *BVol {
+	if len(orths) == 0 {
+		return &BVol{tree: b.settings()}
+	}
+	m := b.Metric
+	if m == nil {
+		m = defaultMetric
+	}
+	bvol := topDown(orths, b.Workers, m)
+	bvol.tree = b.settings()
+	return bvol
+}
+
+// Returns the state a hierarchy built by b starts with, or nil for defaults.
+func (b Builder) settings() *tree {
+	if b.Metric == nil && b.Insertion == GREEDY {
+		return nil
+	}
+	return &tree{metric: b.Metric, insertion: b.Insertion}
+}
+
+func topDown(orths []*Orthotope, workers int, m Metric) *BVol {
 	if len(orths) == 1 {
-		return &BVol{vol: orths[0]}
+		added := *orths[0]
+		return &BVol{vol: orths[0], added: &added}
 	}
 	comp1 := &Orthotope{}
 	comp2 := &Orthotope{}
 	mid := len(orths) / 2
 
 	lowDim := 0
-	lowScore := int32(math.MaxInt32)
+	lowScore := int64(math.MaxInt64)
 	for d := 0; d < DIMENSIONS; d++ {
 		sort.Sort(byDimension{orths: orths, dimension: d})
 		comp1.MinBounds(orths[:mid]...)
 		comp2.MinBounds(orths[mid:]...)
-		score := comp1.Score() + comp2.Score()
+		score := m.Cost(comp1) + m.Cost(comp2)
 		if score < lowScore {
 			lowScore = score
 			lowDim = d
@@ -71,8 +153,19 @@ func TopDownBVH(orths []*Orthotope) *BVol {
 	if lowDim < DIMENSIONS-1 {
 		sort.Sort(byDimension{orths: orths, dimension: lowDim})
 	}
-	bvol := &BVol{vol: comp1,
-		desc: [2]*BVol{TopDownBVH(orths[:mid]), TopDownBVH(orths[mid:])}}
+	bvol := &BVol{vol: comp1}
+	if workers > 1 && mid >= parallelMin {
+		var wait sync.WaitGroup
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			bvol.desc[0] = topDown(orths[:mid], workers/2, m)
+		}()
+		bvol.desc[1] = topDown(orths[mid:], workers-workers/2, m)
+		wait.Wait()
+	} else {
+		bvol.desc = [2]*BVol{topDown(orths[:mid], 1, m), topDown(orths[mid:], 1, m)}
+	}
 	bvol.redepth()
 	bvol.minBound()
 	return bvol
@@ -82,21 +175,65 @@ func (bvol *BVol) GetDepth() int32 {
 	return bvol.depth
 }
 
+// Len returns the number of orthotopes in the hierarchy.
+func (bvol *BVol) Len() int {
+	if bvol.vol == nil {
+		return 0
+	}
+	return int(bvol.leaves())
+}
+
+// IsEmpty checks whether the hierarchy holds no orthotopes.
+func (bvol *BVol) IsEmpty() bool {
+	return bvol.vol == nil
+}
+
+// Bounds returns a copy of the volume bounding every orthotope in the
+// hierarchy, or nil when it is empty.
+func (bvol *BVol) Bounds() *Orthotope {
+	if bvol.vol == nil {
+		return nil
+	}
+	bounds := *bvol.vol
+	return &bounds
+}
+
 // Get an iterator for each volume in a Bounding Volume Hierarhcy.
 func (bvol *BVol) Iterator() *orthStack {
 	stack := &orthStack{bvh: bvol, bvStack: []*BVol{bvol}, intStack: []int32{0}}
 	return stack
 }
 
+// SetMetric sets the metric the hierarchy uses to choose where to add
+// orthotopes and how to rotate volumes, whichever iterator adds them. Nil
+// restores the default ScoreMetric. Only set it on the root volume.
+func (bvol *BVol) SetMetric(m Metric) {
+	bvol.state().metric = m
+}
+
+// Metric returns the metric the hierarchy uses.
+func (bvol *BVol) Metric() Metric {
+	if bvol.tree == nil || bvol.tree.metric == nil {
+		return defaultMetric
+	}
+	return bvol.tree.metric
+}
+
 // Add an orthotope to a Bounding Volume Hierarchy. Only add to root volume.
 func (bvol *BVol) Add(orth *Orthotope) bool {
-	s := bvol.Iterator()
-	return s.Add(orth)
+	return bvol.updater().Add(orth)
 }
 
 func (bvol *BVol) Remove(orth *Orthotope) bool {
-	s := bvol.Iterator()
-	return s.Remove(orth)
+	return bvol.updater().Remove(orth)
+}
+
+// RemoveChecked removes an orthotope, even one modified in place, reporting
+// ErrMutated if it was or ErrNotFound if it is not in the hierarchy. An
+// orthotope not found through its bounds, whether modified or never added, is
+// searched for through every volume, so a miss costs O(n).
+func (bvol *BVol) RemoveChecked(orth *Orthotope) error {
+	return bvol.updater().RemoveChecked(orth)
 }
 
 func (bvol *BVol) Score() int32 {
@@ -111,22 +248,22 @@ func (bvol *BVol) SAH() float64 {
 	return bvol.Iterator().SAH(1.0, 1.2, 0)
 }
 
-// Rebalances the children of a given volume.
-func (bvol *BVol) redistribute() {
+// Rebalances the children of a given volume, swapping to minimize the metric.
+func (bvol *BVol) redistribute(m Metric) {
 	if bvol.desc[1].depth > bvol.desc[0].depth {
-		swapCheck(bvol.desc[1], bvol, 0)
+		swapCheck(bvol.desc[1], bvol, 0, m)
 	} else if bvol.desc[1].depth < bvol.desc[0].depth {
-		swapCheck(bvol.desc[0], bvol, 1)
+		swapCheck(bvol.desc[0], bvol, 1, m)
 	} else if bvol.desc[1].depth > 0 {
-		swapCheck(bvol.desc[0], bvol.desc[1], 1)
+		swapCheck(bvol.desc[0], bvol.desc[1], 1, m)
 	}
 	bvol.redepth()
 }
 
-func swapCheck(first *BVol, second *BVol, secIndex int) {
+func swapCheck(first *BVol, second *BVol, secIndex int, m Metric) {
 	first.minBound()
 	second.minBound()
-	minScore := first.vol.Score() + second.vol.Score()
+	minScore := m.Cost(first.vol) + m.Cost(second.vol)
 	minIndex := -1
 
 	for index := 0; index < 2; index++ {
@@ -138,7 +275,7 @@ func swapCheck(first *BVol, second *BVol, secIndex int) {
 			// Score first then second, since first may be a child of second.
 			first.minBound()
 			second.minBound()
-			score := first.vol.Score() + second.vol.Score()
+			score := m.Cost(first.vol) + m.Cost(second.vol)
 			if score < minScore {
 				// Update the children with the best split
 				minScore = score
@@ -2,10 +2,12 @@
 package rect
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
+	"math/rand"
 	"os"
 	"strings"
 	"testing"
@@ -21,6 +23,33 @@ func TestTopDownBVH(t *testing.T) {
 	}
 }
 
+func TestParallelTopDown(t *testing.T) {
+	orths := randOrths(10, 5000)
+	expected := TopDownBVH(append([]*Orthotope{}, orths...)).String()
+
+	for _, workers := range []int{2, 3, 8} {
+		tree := Builder{Workers: workers}.TopDown(append([]*Orthotope{}, orths...))
+		if tree.String() != expected {
+			t.Errorf("Parallel build with %d workers differs from sequential build.",
+				workers)
+		}
+	}
+	if tree := TopDownBVH(nil); tree.vol != nil {
+		t.Errorf("Expected an empty hierarchy, got:\n%v", tree.String())
+	}
+}
+
+func BenchmarkTopDown(b *testing.B) {
+	orths := randOrths(11, 50000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				Builder{Workers: workers}.TopDown(orths)
+			}
+		})
+	}
+}
+
 func TestSAH(t *testing.T) {
 	configs := []struct {
 		name string
@@ -229,6 +258,19 @@ func getIdealTree() *BVol {
 			},
 		},
 	}
+	// Count the leaves below each volume, as redepth would, and keep the bounds
+	// of each leaf, as Add would.
+	var recount func(bvol *BVol)
+	recount = func(bvol *BVol) {
+		if bvol.depth > 0 {
+			recount(bvol.desc[0])
+			recount(bvol.desc[1])
+			bvol.count = bvol.desc[0].leaves() + bvol.desc[1].leaves()
+		} else {
+			bvol.accept()
+		}
+	}
+	recount(tree)
 	return tree
 }
 
@@ -253,6 +295,21 @@ func drawBVH(BVol *BVol, name string) {
 	_ = png.Encode(myfile, myimage)
 }
 
+// Random orthotopes with non-zero extents in every dimension.
+func randOrths(seed int64, n int) []*Orthotope {
+	r := rand.New(rand.NewSource(seed))
+	orths := make([]*Orthotope, n)
+	for i := range orths {
+		orth := &Orthotope{}
+		for dim := 0; dim < d; dim++ {
+			orth.Delta[dim] = 1 + r.Int31n(20)
+			orth.Point[dim] = r.Int31n(1000)
+		}
+		orths[i] = orth
+	}
+	return orths
+}
+
 var leaf [10]*Orthotope = [10]*Orthotope{
 	{Point: [d]int32{2, 2}, Delta: [d]int32{2, 2}},
 	{Point: [d]int32{7, 7}, Delta: [d]int32{3, 3}},
@@ -265,3 +322,44 @@ var leaf [10]*Orthotope = [10]*Orthotope{
 	{Point: [d]int32{18, 21}, Delta: [d]int32{2, 2}},
 	{Point: [d]int32{19, 19}, Delta: [d]int32{4, 6}},
 }
+
+func TestLen(t *testing.T) {
+	tree := &BVol{}
+	if tree.Len() != 0 || !tree.IsEmpty() || tree.Bounds() != nil {
+		t.Errorf("Empty hierarchy has length %d and bounds %v\n", tree.Len(),
+			tree.Bounds())
+	}
+	orths := randOrths(71, 300)
+	iter := tree.Iterator()
+	for index, orth := range orths {
+		iter.Add(orth)
+		if tree.Len() != index+1 {
+			t.Errorf("Length %d after %d additions\n", tree.Len(), index+1)
+		}
+	}
+	iter.Add(orths[0])
+	for index, orth := range orths {
+		iter.Remove(orth)
+		if tree.Len() != len(orths)-index-1 {
+			t.Errorf("Length %d after %d removals\n", tree.Len(), index+1)
+		}
+	}
+	if !tree.IsEmpty() || tree.Bounds() != nil {
+		t.Errorf("Hierarchy not empty after removing everything\n")
+	}
+
+	tree = TopDownBVH(orths)
+	bounds := tree.Bounds()
+	if tree.Len() != len(orths) || !bounds.Equals(tree.vol) {
+		t.Errorf("Built hierarchy has length %d and bounds %v\n", tree.Len(),
+			bounds.String())
+	}
+	// Bounds are a copy, so changing them leaves the hierarchy alone.
+	bounds.Delta[0] = 0
+	if tree.vol.Delta[0] == 0 {
+		t.Errorf("Changing the bounds changed the hierarchy\n")
+	}
+	if getIdealTree().Len() != len(leaf) {
+		t.Errorf("Ideal hierarchy has length %d\n", getIdealTree().Len())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"iter"
+)
+
+// Query returns a sequence of the orthotopes in the hierarchy that overlap o.
+// Each call to the sequence uses its own iterator, so no Reset is required.
+func (bvol *BVol) Query(o *Orthotope) iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		bvol.Iterator().query(o, yield)
+	}
+}
+
+// Trace returns a sequence of the orthotopes intersected by the vector o along
+// with their distances, nearest branches first.
+func (bvol *BVol) Trace(o *Orthotope) iter.Seq2[*Orthotope, int32] {
+	return func(yield func(*Orthotope, int32) bool) {
+		bvol.Iterator().trace(o, yield)
+	}
+}
+
+// Resets the stack and yields each volume overlapping o until yield is false.
+func (s *orthStack) query(o *Orthotope, yield func(*Orthotope) bool) {
+	// Nothing below the root can overlap o if the root does not.
+	if s.bvh.vol == nil || !s.bvh.vol.Overlaps(o) {
+		return
+	}
+	s.Reset()
+	for r := s.Query(o); r != nil; r = s.Query(o) {
+		if !yield(r) {
+			return
+		}
+	}
+}
+
+// Resets the stack and yields each volume intersecting o until yield is false.
+func (s *orthStack) trace(o *Orthotope, yield func(*Orthotope, int32) bool) {
+	if s.bvh.vol == nil {
+		return
+	}
+	if s.bvh.depth == 0 {
+		// A lone leaf is never measured by the iterator, so measure it here.
+		if distance := o.Intersects(s.bvh.vol); distance >= 0 {
+			yield(s.bvh.vol, distance)
+		}
+		return
+	}
+	s.Reset()
+	for r, d := s.Trace(o); r != nil; r, d = s.Trace(o) {
+		if !yield(r, d) {
+			return
+		}
+	}
+}
+
+// Leaves returns a sequence of every orthotope in the hierarchy in pre-order.
+func (bvol *BVol) Leaves() iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		for n := range bvol.Nodes() {
+			if n.depth == 0 && !yield(n.vol) {
+				return
+			}
+		}
+	}
+}
+
+// Nodes returns a sequence of every volume, internal or leaf, in pre-order.
+func (bvol *BVol) Nodes() iter.Seq[*BVol] {
+	return func(yield func(*BVol) bool) {
+		if bvol.vol == nil {
+			return
+		}
+		s := bvol.Iterator()
+		for s.HasNext() {
+			if !yield(s.Next()) {
+				return
+			}
+		}
+	}
+}
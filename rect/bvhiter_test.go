@@ -0,0 +1,123 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestQuerySeq(t *testing.T) {
+	tree := getIdealTree()
+	query := [4]*Orthotope{
+		{Point: [d]int32{11, 12}, Delta: [d]int32{0, 0}},
+		{Point: [d]int32{14, 15}, Delta: [d]int32{0, 0}},
+		{Point: [d]int32{-2, -2}, Delta: [d]int32{30, 30}},
+		{Point: [d]int32{17, 9}, Delta: [d]int32{5, 5}},
+	}
+	counts := [4]int{1, 0, len(leaf), 3}
+
+	for in, q := range query {
+		// Run each query twice to show that no Reset is needed.
+		for run := 0; run < 2; run++ {
+			count := 0
+			for r := range tree.Query(q) {
+				if !r.Overlaps(q) {
+					t.Errorf("Querying %v returned unexpected value: %v\n",
+						q.String(), r.String())
+				}
+				count++
+			}
+			if count != counts[in] {
+				t.Errorf("Querying %v returned %d values, expected %d\n",
+					q.String(), count, counts[in])
+			}
+		}
+	}
+
+	single := &BVol{}
+	single.Add(leaf[0])
+	for r := range single.Query(query[0]) {
+		t.Errorf("Querying a single leaf returned non-overlapping %v\n", r.String())
+	}
+	for r := range (&BVol{}).Query(leaf[0]) {
+		t.Errorf("Querying an empty hierarchy returned %v\n", r.String())
+	}
+}
+
+func TestTraceSeq(t *testing.T) {
+	tree := getIdealTree()
+	q := &Orthotope{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}}
+	results := []*Orthotope{leaf[7], leaf[3], leaf[2]}
+
+	for r := range tree.Trace(q) {
+		if len(results) > 0 && results[0] == r {
+			results = results[1:]
+		} else {
+			t.Errorf("Tracing %v returned unexpected or out of order value: %v\n",
+				q.String(), r.String())
+		}
+	}
+	for _, orth := range results {
+		t.Errorf("Tracing %v did not return %v\n", q.String(), orth.String())
+	}
+
+	single := &BVol{}
+	single.Add(leaf[0])
+	miss := &Orthotope{Point: [d]int32{0, 40}, Delta: [d]int32{5, -1}}
+	for r := range single.Trace(miss) {
+		t.Errorf("Tracing a single leaf returned a missed volume %v\n", r.String())
+	}
+	hit := &Orthotope{Point: [d]int32{-2, 0}, Delta: [d]int32{4, 2}}
+	for r, dist := range single.Trace(hit) {
+		if r != leaf[0] || dist <= 0 {
+			t.Errorf("Tracing a single leaf returned %v at %d\n", r.String(), dist)
+		}
+	}
+}
+
+func TestLeavesAndNodes(t *testing.T) {
+	tree := getIdealTree()
+	found := map[*Orthotope]bool{}
+	for orth := range tree.Leaves() {
+		found[orth] = true
+	}
+	for _, orth := range leaf {
+		if !found[orth] {
+			t.Errorf("Leaves did not return %v\n", orth.String())
+		}
+	}
+
+	nodes := 0
+	for n := range tree.Nodes() {
+		if nodes == 0 && n != tree {
+			t.Errorf("Nodes did not start with the root.\n")
+		}
+		nodes++
+	}
+	if nodes != 2*len(leaf)-1 {
+		t.Errorf("Nodes returned %d volumes, expected %d\n", nodes, 2*len(leaf)-1)
+	}
+	for n := range (&BVol{}).Nodes() {
+		t.Errorf("Nodes of an empty hierarchy returned %v\n", n.String())
+	}
+}
+
+func TestNestedSeq(t *testing.T) {
+	tree := getIdealTree()
+	all := &Orthotope{Point: [d]int32{-2, -2}, Delta: [d]int32{30, 30}}
+
+	// Nested loops over the same tree must not share traversal state.
+	pairs := 0
+	for range tree.Query(all) {
+		for range tree.Query(all) {
+			pairs++
+		}
+	}
+	if pairs != len(leaf)*len(leaf) {
+		t.Errorf("Nested queries returned %d pairs, expected %d\n", pairs,
+			len(leaf)*len(leaf))
+	}
+
+	for range tree.Leaves() {
+		break
+	}
+}
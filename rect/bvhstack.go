@@ -2,9 +2,18 @@
 package rect
 
 import (
+	"errors"
 	"math"
 )
 
+// ErrNotFound is returned when removing an orthotope not in the hierarchy.
+var ErrNotFound = errors.New("rect: orthotope not found")
+
+// ErrMutated is returned when a removed orthotope differs from when it was
+// added, since it was modified in place while in the hierarchy. Move
+// orthotopes by removing, modifying then adding them, or refit after.
+var ErrMutated = errors.New("rect: orthotope modified in place")
+
 // OrthStack gives methods for working with Orthotope BVol.
 type OrthStack interface {
 	Reset()
@@ -21,6 +30,19 @@ type orthStack struct {
 	bvh      *BVol
 	bvStack  []*BVol
 	intStack []int32
+	// Volumes copied during a persistent update. Nil when updating in place.
+	owned map[*BVol]bool
+}
+
+// SetMetric sets the metric of the BVH associated with this stack. See
+// BVol.SetMetric.
+func (s *orthStack) SetMetric(m Metric) {
+	s.bvh.SetMetric(m)
+}
+
+// Returns the metric of the BVH associated with this stack.
+func (s *orthStack) Metric() Metric {
+	return s.bvh.Metric()
 }
 
 // Resets the stack.
@@ -40,6 +62,32 @@ func (s *orthStack) append(bvol *BVol, index int32) {
 	s.intStack = append(s.intStack, index)
 }
 
+// Copies any child of bvol shared with an older hierarchy so that it may be
+// modified. Does nothing when updating in place.
+func (s *orthStack) ownChildren(bvol *BVol) {
+	if s.owned == nil || bvol.depth == 0 {
+		return
+	}
+	for index, child := range bvol.desc {
+		if !s.owned[child] {
+			child = child.copyNode()
+			s.owned[child] = true
+			bvol.desc[index] = child
+		}
+	}
+}
+
+// Replaces the volumes on the stack with copies so that they may be modified.
+func (s *orthStack) ownPath() {
+	if s.owned == nil {
+		return
+	}
+	for i := 0; i < len(s.bvStack)-1; i++ {
+		s.ownChildren(s.bvStack[i])
+		s.bvStack[i+1] = s.bvStack[i].desc[s.intStack[i]]
+	}
+}
+
 func (s *orthStack) peek() (*BVol, int32) {
 	return s.bvStack[len(s.bvStack)-1], s.intStack[len(s.intStack)-1]
 }
@@ -169,7 +217,9 @@ func (s *orthStack) Query(o *Orthotope) *Orthotope {
 	return bvol.vol
 }
 
-func (s *orthStack) path(o *Orthotope) *BVol {
+// Searches for the leaf o, leaving the path to it on the stack. Only volumes
+// containing o are searched, unless scan is set to search every volume.
+func (s *orthStack) path(o *Orthotope, scan bool) *BVol {
 	bvol, index := s.peek()
 	for bvol.vol != o && s.HasNext() {
 		if bvol.depth == 0 {
@@ -184,7 +234,7 @@ func (s *orthStack) path(o *Orthotope) *BVol {
 					break
 				}
 			} else {
-				if bvol.desc[index].vol.Contains(o) {
+				if scan || bvol.desc[index].vol.Contains(o) {
 					s.append(bvol.desc[index], 0)
 				} else {
 					s.intStack[len(s.intStack)-1]++
@@ -198,7 +248,7 @@ func (s *orthStack) path(o *Orthotope) *BVol {
 
 func (s *orthStack) Contains(o *Orthotope) bool {
 	s.Reset()
-	bvol := s.path(o)
+	bvol := s.path(o, false)
 
 	// Check that the orthotope is the last thing from the path.
 	return o == bvol.vol
@@ -206,37 +256,41 @@ func (s *orthStack) Contains(o *Orthotope) bool {
 
 // Add an orthotope to a Bounding Volume Hierarchy. Only add to root volume.
 func (s *orthStack) Add(orth *Orthotope) bool {
+	s.bvh.changed()
 	s.Reset()
 	bvol := s.bvh
 	if bvol.vol == nil {
 		// Add by setting the vol when there is no volumes.
 		bvol.vol = orth
+		bvol.added = s.copyVol(orth)
+	} else if s.bvh.Insertion() == BRANCH_AND_BOUND {
+		return s.addBest(orth)
 	}
-	comp := Orthotope{}
+	m := s.Metric()
 	lowIndex := int32(-1)
 
 	for next := bvol; next.vol != orth; next = next.desc[lowIndex] {
 		if next.depth == 0 {
 			// We've reached a leaf node, and we need to insert a parent node.
-			next.desc[0] = &BVol{vol: orth}
-			next.desc[1] = &BVol{vol: next.vol}
-			next.depth = 1
-			comp = *next.vol
-			next.vol = &comp
+			next.desc[0] = s.newLeaf(orth)
+			next.desc[1] = s.moveLeaf(next)
+			next.redepth()
+			comp := s.newVol()
+			*comp = *next.vol
+			next.vol = comp
 			lowIndex = int32(0)
 		} else {
 			// We cannot add the orthotope here. Descend.
-			smallestScore := int32(math.MaxInt32)
+			s.ownChildren(next)
+			smallestScore := int64(math.MaxInt64)
 
 			for index, vol := range next.desc {
-				comp.MinBounds(orth, vol.vol)
-
 				if vol.vol == orth {
 					// The volume has already been added.
 					return false
 				}
 
-				score := comp.Score() - vol.vol.Score()
+				score := m.Enlargement(vol.vol, next.desc[index^1].vol, orth)
 				if score < smallestScore {
 					lowIndex = int32(index)
 					smallestScore = score
@@ -254,30 +308,72 @@ func (s *orthStack) Add(orth *Orthotope) bool {
 // Remove an orthotope from the BVH associated with this stack.
 func (s *orthStack) Remove(o *Orthotope) bool {
 	s.Reset()
-	bvol := s.path(o)
+	bvol := s.path(o, false)
 	if o == bvol.vol {
-		s.pop()
+		s.removeLeaf(bvol)
+		return true
+	}
+	return false
+}
+
+// RemoveChecked removes an orthotope like Remove, but also finds orthotopes
+// modified in place, which may lie outside the volumes holding them, by
+// searching the whole hierarchy in O(n) whenever it is not found through its
+// bounds, including when it was never added. Each leaf keeps a copy of its orthotope as it
+// was added, so it returns ErrMutated exactly when the removed orthotope was
+// modified since, or ErrNotFound if it is not in the hierarchy.
+func (s *orthStack) RemoveChecked(o *Orthotope) error {
+	s.Reset()
+	bvol := s.path(o, false)
+	if o != bvol.vol {
+		s.Reset()
+		bvol = s.path(o, true)
+		if o != bvol.vol {
+			return ErrNotFound
+		}
+	}
+	mutated := bvol.mutated()
+	// Removal refits the volumes above, which may still bound the old position.
+	s.removeLeaf(bvol)
+	if mutated {
+		return ErrMutated
+	}
+	return nil
+}
+
+// Removes the leaf found by path.
+func (s *orthStack) removeLeaf(bvol *BVol) {
+	s.bvh.changed()
+	s.ownPath()
+	s.pop()
+	if s.HasNext() {
+		parent, pIndex := s.pop()
 		if s.HasNext() {
-			parent, pIndex := s.pop()
-			if s.HasNext() {
-				gParent, gIndex := s.peek()
-				// Delete the node by replacing the parent.
-				gParent.desc[gIndex] = parent.desc[pIndex^1]
-				s.rebalanceRemove()
-			} else {
-				// Delete the node by replacing the volume and children with cousin.
-				cousin := parent.desc[pIndex^1]
-				parent.vol = cousin.vol
-				parent.desc = cousin.desc
-				parent.depth = cousin.depth
-			}
+			gParent, gIndex := s.peek()
+			// Delete the node by replacing the parent.
+			gParent.desc[gIndex] = parent.desc[pIndex^1]
+			s.rebalanceRemove()
+			s.freeVol(parent.vol)
+			s.freeNode(parent)
 		} else {
-			// For depths of 0, delete by removing the volume.
-			bvol.vol = nil
+			// Delete the node by replacing the volume and children with cousin.
+			cousin := parent.desc[pIndex^1]
+			s.freeVol(parent.vol)
+			parent.vol = cousin.vol
+			parent.desc = cousin.desc
+			parent.depth = cousin.depth
+			parent.count = cousin.count
+			parent.added = cousin.added
+			s.freeNode(cousin)
 		}
-		return true
+		s.freeVol(bvol.added)
+		s.freeNode(bvol)
+	} else {
+		// For depths of 0, delete by removing the volume.
+		s.freeVol(bvol.added)
+		bvol.vol = nil
+		bvol.added = nil
 	}
-	return false
 }
 
 // Returns the total score by using the volumes Score method for each volume.
@@ -312,10 +408,12 @@ func (s *orthStack) SAH(cInternal, cLeaves, cOverlap float64) float64 {
 
 // Attempt rebalancing when the depth of the tree has potentially increased.
 func (s *orthStack) rebalanceAdd() {
+	m := s.Metric()
 	gParent, gIndex := s.pop()
 	for s.HasNext() {
 		parent, pIndex := gParent, gIndex
 		gParent, gIndex = s.pop()
+		s.ownChildren(gParent)
 
 		aIndex := gIndex ^ 1
 
@@ -325,7 +423,7 @@ func (s *orthStack) rebalanceAdd() {
 				gParent.desc[aIndex], parent.desc[pIndex]
 			parent.redepth()
 		}
-		gParent.redistribute()
+		gParent.redistribute(m)
 		// Found that gParent was not consistently getting minBound after redistribute.
 		gParent.minBound()
 	}
@@ -334,8 +432,10 @@ func (s *orthStack) rebalanceAdd() {
 
 // Attempt rebalancing when the depth of the tree has potentially decreased.
 func (s *orthStack) rebalanceRemove() {
+	m := s.Metric()
 	for s.HasNext() {
 		parent, pIndex := s.pop()
+		s.ownChildren(parent)
 
 		cIndex := pIndex ^ 1
 		cousin := parent.desc[cIndex]
@@ -347,9 +447,9 @@ func (s *orthStack) rebalanceRemove() {
 			if cousin.desc[1].depth == depth+1 {
 				if cousin.desc[0].depth == depth+1 {
 					cousin.vol.MinBounds(cousin.desc[1].vol, parent.desc[pIndex].vol)
-					score := cousin.vol.Score() - cousin.desc[1].vol.Score()
+					score := m.Cost(cousin.vol) - m.Cost(cousin.desc[1].vol)
 					cousin.vol.MinBounds(cousin.desc[0].vol, parent.desc[pIndex].vol)
-					if score < cousin.vol.Score()-cousin.desc[0].vol.Score() {
+					if score < m.Cost(cousin.vol)-m.Cost(cousin.desc[0].vol) {
 						swap = 1
 					}
 				} else {
@@ -360,8 +460,10 @@ func (s *orthStack) rebalanceRemove() {
 				cousin.desc[swap], parent.desc[pIndex]
 			cousin.redepth()
 			cousin.minBound()
+			// The swapped in grandchild may be shared with an older hierarchy.
+			s.ownChildren(parent)
 		}
 		parent.minBound()
-		parent.redistribute()
+		parent.redistribute(m)
 	}
 }
@@ -2,6 +2,7 @@
 package rect
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -154,3 +155,57 @@ func TestBVHContains(t *testing.T) {
 		}
 	}
 }
+
+func TestRemoveChecked(t *testing.T) {
+	orths := randOrths(73, 300)
+	tree := TopDownBVH(orths)
+	if err := tree.RemoveChecked(orths[0]); err != nil {
+		t.Errorf("Removing %v returned %v\n", orths[0].String(), err)
+	}
+	if err := tree.RemoveChecked(orths[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Removing a missing orthotope returned %v\n", err)
+	}
+
+	// Move orthotopes in place, out of the volumes that held them.
+	moved := orths[1:20]
+	for _, orth := range moved {
+		orth.Point[0] += 5000
+		if tree.Remove(orth) {
+			t.Errorf("Removed moved orthotope %v by its bounds\n", orth.String())
+		}
+	}
+	// Shrink one in place, so that it stays inside the volumes holding it.
+	inside := orths[len(moved)+1]
+	inside.Point[1]++
+	inside.Delta[1]--
+	moved = append(moved, inside)
+	if tree.Validate() == nil {
+		t.Errorf("Validate did not report the moved orthotopes\n")
+	}
+	// Refitting after a removal may grow volumes to hold other moved
+	// orthotopes, which must still be reported.
+	for _, orth := range moved {
+		if err := tree.RemoveChecked(orth); !errors.Is(err, ErrMutated) {
+			t.Errorf("Removing moved %v returned %v\n", orth.String(), err)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Hierarchy invalid after removing moved orthotopes: %v\n", err)
+	}
+	if tree.Len() != len(orths)-len(moved)-1 {
+		t.Errorf("Length %d, expected %d\n", tree.Len(), len(orths)-len(moved)-1)
+	}
+	for _, orth := range orths[len(moved)+1:] {
+		if !tree.Iterator().Contains(orth) {
+			t.Errorf("Lost %v\n", orth.String())
+		}
+	}
+
+	single := &BVol{}
+	mutated := &Orthotope{Point: [d]int32{1, 1, 1}, Delta: [d]int32{1, 1, 1}}
+	single.Add(mutated)
+	mutated.Delta[0] = 3
+	if err := single.RemoveChecked(mutated); !errors.Is(err, ErrMutated) || !single.IsEmpty() {
+		t.Errorf("Removing a lone leaf returned %v\n", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+// Clear empties the hierarchy, keeping its volumes and internal bounds for
+// reuse by later additions. As with Remove, volumes that may be shared with a
+// snapshot are left to the garbage collector.
+func (bvol *BVol) Clear() {
+	bvol.updater().Clear()
+}
+
+// Clear empties the BVH associated with this stack. See BVol.Clear.
+func (s *orthStack) Clear() {
+	if s.bvh.vol != nil && s.bvh.depth > 0 {
+		s.freeVol(s.bvh.vol)
+		s.freeChildren(s.bvh)
+	} else if s.bvh.vol != nil {
+		s.freeVol(s.bvh.added)
+	}
+	s.bvh.replace(nil)
+	s.Reset()
+}
+
+// Frees the volumes below an internal volume.
+func (s *orthStack) freeChildren(bvol *BVol) {
+	for _, child := range bvol.desc {
+		if child.depth > 0 {
+			s.freeVol(child.vol)
+			s.freeChildren(child)
+		} else {
+			s.freeVol(child.added)
+		}
+		s.freeNode(child)
+	}
+}
+
+// Clone returns a deep copy of the hierarchy, with new volumes and internal
+// bounds. Leaves share the orthotopes of bvol unless copyLeaves is set, in
+// which case each leaf holds a new copy of its orthotope. The clone uses the
+// same metric.
+func (bvol *BVol) Clone(copyLeaves bool) *BVol {
+	clone := &BVol{}
+	if bvol.vol != nil {
+		bvol.clone(clone, copyLeaves)
+	}
+	clone.tree = bvol.tree.settings()
+	return clone
+}
+
+func (bvol *BVol) clone(into *BVol, copyLeaves bool) {
+	*into = *bvol
+	into.tree = nil
+	into.desc = [2]*BVol{}
+	if bvol.depth == 0 {
+		if bvol.added != nil {
+			added := *bvol.added
+			into.added = &added
+		}
+		if copyLeaves {
+			vol := *bvol.vol
+			into.vol = &vol
+		}
+		return
+	}
+	vol := *bvol.vol
+	into.vol = &vol
+	into.desc = [2]*BVol{{}, {}}
+	bvol.desc[0].clone(into.desc[0], copyLeaves)
+	bvol.desc[1].clone(into.desc[1], copyLeaves)
+}
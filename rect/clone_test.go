@@ -0,0 +1,82 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	tree := getIdealTree()
+	clone := tree.Clone(false)
+	if !clone.Equals(tree) || clone.Len() != tree.Len() {
+		t.Errorf("Clone differs from the original\n")
+	}
+	for n := range clone.Nodes() {
+		for o := range tree.Nodes() {
+			if n == o || (n.depth > 0 && n.vol == o.vol) {
+				t.Errorf("Clone shares a volume with the original\n")
+			}
+		}
+	}
+
+	deep := tree.Clone(true)
+	if deep.Equals(tree) || !sameTree(deep, tree) {
+		t.Errorf("Deep clone does not hold copies of the leaves\n")
+	}
+	for orth := range deep.Leaves() {
+		for _, l := range leaf {
+			if orth == l {
+				t.Errorf("Deep clone shares the leaf %v\n", l.String())
+			}
+		}
+	}
+
+	// Changing a clone leaves the original alone.
+	iter := clone.Iterator()
+	for _, orth := range leaf[:5] {
+		iter.Remove(orth)
+	}
+	iter.Add(&Orthotope{Point: [d]int32{40, 40}, Delta: [d]int32{2, 2}})
+	if !tree.Equals(getIdealTree()) {
+		t.Errorf("Changing a clone changed the original\n")
+	}
+	if (&BVol{}).Clone(true).Len() != 0 {
+		t.Errorf("Clone of an empty hierarchy is not empty\n")
+	}
+}
+
+func TestClear(t *testing.T) {
+	orths := randOrths(72, 200)
+	tree := TopDownBVH(orths)
+	tree.Clear()
+	if !tree.IsEmpty() || tree.Len() != 0 {
+		t.Errorf("Hierarchy not empty after Clear\n")
+	}
+
+	iter := tree.Iterator()
+	for _, orth := range orths {
+		iter.Add(orth)
+	}
+	iter.Clear()
+	if nodes, vols := freed(tree); !tree.IsEmpty() || nodes != 2*len(orths)-2 ||
+		vols != 2*len(orths)-1 {
+		t.Errorf("Clear kept %d volumes and %d bounds, expected %d and %d\n",
+			nodes, vols, 2*len(orths)-2, 2*len(orths)-1)
+	}
+	allocs := testing.AllocsPerRun(1, func() {
+		for _, orth := range orths {
+			iter.Add(orth)
+		}
+		iter.Clear()
+	})
+	if allocs != 0 {
+		t.Errorf("Adding after Clear allocated %v times, expected none\n", allocs)
+	}
+	for _, orth := range orths {
+		iter.Add(orth)
+	}
+	checkTree(t, tree)
+	if tree.Len() != len(orths) {
+		t.Errorf("Length %d after adding again, expected %d\n", tree.Len(), len(orths))
+	}
+}
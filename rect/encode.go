@@ -0,0 +1,254 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The encoding is little endian: the magic, the version, DIMENSIONS and the
+// number of volumes, followed by each volume in pre-order as its depth, Point
+// and Delta, plus an ID for leaves, and finally a CRC-32 of everything before.
+var encodingMagic = [4]byte{'B', 'V', 'O', 'L'}
+
+const encodingVersion uint16 = 1
+
+// Deeper than any balanced hierarchy that fits in memory.
+const maxEncodedDepth = 64
+
+// ErrEncoding is returned when decoding input that is not a valid hierarchy.
+var ErrEncoding = errors.New("rect: invalid BVol encoding")
+
+// Encode writes the hierarchy to w, identifying each leaf by id.
+func (bvol *BVol) Encode(w io.Writer, id func(*Orthotope) uint64) error {
+	_, err := w.Write(bvol.appendEncoding(nil, id))
+	return err
+}
+
+// MarshalBinary encodes the hierarchy, identifying each leaf by its index in
+// pre-order.
+func (bvol *BVol) MarshalBinary() ([]byte, error) {
+	ids := map[*Orthotope]uint64{}
+	for orth := range bvol.Leaves() {
+		ids[orth] = uint64(len(ids))
+	}
+	return bvol.appendEncoding(nil, func(orth *Orthotope) uint64 {
+		return ids[orth]
+	}), nil
+}
+
+func (bvol *BVol) appendEncoding(buf []byte, id func(*Orthotope) uint64) []byte {
+	buf = append(buf, encodingMagic[:]...)
+	buf = binary.LittleEndian.AppendUint16(buf, encodingVersion)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(DIMENSIONS))
+	// The count is filled in once the volumes are written, rather than trusting
+	// the counts cached in them.
+	header := len(buf)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	count := uint32(0)
+	for n := range bvol.Nodes() {
+		count++
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n.depth))
+		for _, p := range n.vol.Point {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(p))
+		}
+		for _, d := range n.vol.Delta {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(d))
+		}
+		if n.depth == 0 {
+			buf = binary.LittleEndian.AppendUint64(buf, id(n.vol))
+		}
+	}
+	binary.LittleEndian.PutUint32(buf[header:], count)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// Decode reads a hierarchy written by Encode. leaf is called with the ID and
+// bounds of each leaf and returns the orthotope to hold, which should have
+// those bounds, or nil to fail with ErrEncoding. A nil leaf allocates a copy of
+// the bounds instead. Nothing is built until the whole input has been checked.
+func Decode(r io.Reader, leaf func(id uint64, bounds Orthotope) *Orthotope) (*BVol, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data, leaf)
+}
+
+// UnmarshalBinary replaces the hierarchy with one encoded by MarshalBinary or
+// Encode, holding newly allocated leaves.
+func (bvol *BVol) UnmarshalBinary(data []byte) error {
+	decoded, err := decode(data, nil)
+	if err != nil {
+		return err
+	}
+	bvol.replace(decoded)
+	return nil
+}
+
+// A volume as read, before the hierarchy is built.
+type encodedNode struct {
+	depth int32
+	vol   Orthotope
+	id    uint64
+}
+
+type decoder struct {
+	data  []byte
+	nodes []encodedNode
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if len(d.data) < 4 {
+		return 0, fmt.Errorf("%w: truncated", ErrEncoding)
+	}
+	v := binary.LittleEndian.Uint32(d.data)
+	d.data = d.data[4:]
+	return v, nil
+}
+
+func decode(data []byte, leaf func(id uint64, bounds Orthotope) *Orthotope) (*BVol, error) {
+	if len(data) < 16 || !bytes.Equal(data[:4], encodingMagic[:]) {
+		return nil, fmt.Errorf("%w: missing header", ErrEncoding)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrEncoding)
+	}
+	if v := binary.LittleEndian.Uint16(body[4:]); v != encodingVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrEncoding, v)
+	}
+	if dims := binary.LittleEndian.Uint16(body[6:]); int(dims) != DIMENSIONS {
+		return nil, fmt.Errorf("%w: %d dimensions, expected %d", ErrEncoding, dims,
+			DIMENSIONS)
+	}
+	count := binary.LittleEndian.Uint32(body[8:])
+
+	d := &decoder{data: body[12:]}
+	for i := uint32(0); i < count; i++ {
+		if err := d.readNode(); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.data) > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrEncoding, len(d.data))
+	}
+
+	bvol := &BVol{}
+	if count == 0 {
+		return bvol, nil
+	}
+	next, err := checkEncoded(d.nodes, 0, maxEncodedDepth)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(d.nodes) {
+		return nil, fmt.Errorf("%w: %d volumes outside the hierarchy", ErrEncoding,
+			len(d.nodes)-next)
+	}
+	if _, err := buildEncoded(bvol, d.nodes, 0, leaf); err != nil {
+		return nil, err
+	}
+	return bvol, nil
+}
+
+func (d *decoder) readNode() error {
+	n := encodedNode{}
+	var values [1 + 2*DIMENSIONS]uint32
+	for index := range values {
+		v, err := d.uint32()
+		if err != nil {
+			return err
+		}
+		values[index] = v
+	}
+	n.depth = int32(values[0])
+	for index := 0; index < DIMENSIONS; index++ {
+		n.vol.Point[index] = int32(values[1+index])
+		n.vol.Delta[index] = int32(values[1+DIMENSIONS+index])
+	}
+	if n.depth == 0 {
+		if len(d.data) < 8 {
+			return fmt.Errorf("%w: truncated", ErrEncoding)
+		}
+		n.id = binary.LittleEndian.Uint64(d.data)
+		d.data = d.data[8:]
+	}
+	d.nodes = append(d.nodes, n)
+	return nil
+}
+
+// Checks the volume at index and those below it, returning the index following
+// its subtree. Depths must be exact, balanced and below limit, and each
+// internal volume must contain its children.
+func checkEncoded(nodes []encodedNode, index int, limit int32) (int, error) {
+	if index >= len(nodes) {
+		return 0, fmt.Errorf("%w: missing volumes", ErrEncoding)
+	}
+	n := &nodes[index]
+	if n.depth < 0 || n.depth >= limit {
+		return 0, fmt.Errorf("%w: volume %d has depth %d", ErrEncoding, index,
+			n.depth)
+	}
+	if n.depth == 0 {
+		return index + 1, nil
+	}
+	first := index + 1
+	second, err := checkEncoded(nodes, first, n.depth)
+	if err != nil {
+		return 0, err
+	}
+	next, err := checkEncoded(nodes, second, n.depth)
+	if err != nil {
+		return 0, err
+	}
+	d0, d1 := nodes[first].depth, nodes[second].depth
+	if max(d0, d1)+1 != n.depth || d0-d1 > 1 || d1-d0 > 1 {
+		return 0, fmt.Errorf("%w: volume %d has depth %d over children of %d and %d",
+			ErrEncoding, index, n.depth, d0, d1)
+	}
+	if !n.vol.Contains(&nodes[first].vol) || !n.vol.Contains(&nodes[second].vol) {
+		return 0, fmt.Errorf("%w: volume %d does not contain its children",
+			ErrEncoding, index)
+	}
+	return next, nil
+}
+
+// Builds the checked volume at index into bvol, returning the index following
+// its subtree. Fails if leaf returns no orthotope for an ID.
+func buildEncoded(bvol *BVol, nodes []encodedNode, index int,
+	leaf func(id uint64, bounds Orthotope) *Orthotope) (int, error) {
+	n := &nodes[index]
+	bvol.depth = n.depth
+	if n.depth == 0 {
+		if leaf != nil {
+			bvol.vol = leaf(n.id, n.vol)
+			if bvol.vol == nil {
+				return 0, fmt.Errorf("%w: no orthotope for leaf %d", ErrEncoding, n.id)
+			}
+		} else {
+			vol := n.vol
+			bvol.vol = &vol
+		}
+		added := n.vol
+		bvol.added = &added
+		return index + 1, nil
+	}
+	vol := n.vol
+	bvol.vol = &vol
+	bvol.desc = [2]*BVol{{}, {}}
+	next, err := buildEncoded(bvol.desc[0], nodes, index+1, leaf)
+	if err != nil {
+		return 0, err
+	}
+	next, err = buildEncoded(bvol.desc[1], nodes, next, leaf)
+	if err != nil {
+		return 0, err
+	}
+	bvol.redepth()
+	return next, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// Checks that two hierarchies have the same topology, depths and bounds.
+func sameTree(first *BVol, second *BVol) bool {
+	if (first.vol == nil) != (second.vol == nil) {
+		return false
+	}
+	if first.vol == nil {
+		return true
+	}
+	if first.depth != second.depth || !first.vol.Equals(second.vol) {
+		return false
+	}
+	return first.depth == 0 || (sameTree(first.desc[0], second.desc[0]) &&
+		sameTree(first.desc[1], second.desc[1]))
+}
+
+func TestMarshalBinary(t *testing.T) {
+	for _, tree := range []*BVol{{}, TopDownBVH(randOrths(56, 1)),
+		TopDownBVH(randOrths(57, 1000))} {
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Errorf("Unable to marshal: %v\n", err)
+		}
+		decoded := &BVol{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Errorf("Unable to unmarshal: %v\n", err)
+		}
+		if !sameTree(tree, decoded) {
+			t.Errorf("Unmarshaled hierarchy differs from the original\n")
+		}
+		checkTree(t, decoded)
+	}
+}
+
+func TestMarshalStaleCount(t *testing.T) {
+	// The header counts the volumes written, not the count cached in the root.
+	tree := TopDownBVH(randOrths(59, 100))
+	tree.count = 7
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Errorf("Unable to marshal: %v\n", err)
+	}
+	if count := binary.LittleEndian.Uint32(data[8:]); count != 199 {
+		t.Errorf("Header counts %d volumes, expected 199\n", count)
+	}
+	decoded := &BVol{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Errorf("Unable to unmarshal: %v\n", err)
+	}
+	if !sameTree(tree, decoded) {
+		t.Errorf("Unmarshaled hierarchy differs from the original\n")
+	}
+}
+
+func TestEncodeIDs(t *testing.T) {
+	orths := randOrths(58, 300)
+	ids := map[*Orthotope]uint64{}
+	for index, orth := range orths {
+		ids[orth] = uint64(index) * 1000003
+	}
+	tree := &BVol{}
+	for _, orth := range orths {
+		tree.Add(orth)
+	}
+	buf := &bytes.Buffer{}
+	if err := tree.Encode(buf, func(orth *Orthotope) uint64 {
+		return ids[orth]
+	}); err != nil {
+		t.Errorf("Unable to encode: %v\n", err)
+	}
+	decoded, err := Decode(buf, func(id uint64, bounds Orthotope) *Orthotope {
+		orth := orths[id/1000003]
+		if !orth.Equals(&bounds) {
+			t.Errorf("Leaf %d decoded as %v, expected %v\n", id, bounds.String(),
+				orth.String())
+		}
+		return orth
+	})
+	if err != nil {
+		t.Errorf("Unable to decode: %v\n", err)
+	}
+	if !sameTree(tree, decoded) {
+		t.Errorf("Decoded hierarchy differs from the original\n")
+	}
+	for _, orth := range orths {
+		if !decoded.Iterator().Contains(orth) {
+			t.Errorf("Decoded hierarchy does not hold %v\n", orth.String())
+		}
+	}
+
+	// Leaves without an orthotope fail the whole decoding.
+	data, _ := tree.MarshalBinary()
+	decoded, err = Decode(bytes.NewReader(data), func(id uint64,
+		bounds Orthotope) *Orthotope {
+		return nil
+	})
+	if decoded != nil || !errors.Is(err, ErrEncoding) {
+		t.Errorf("Decoded nil leaves with error %v\n", err)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	data, _ := getIdealTree().MarshalBinary()
+	for index := range data {
+		corrupt := append([]byte(nil), data...)
+		corrupt[index] ^= 0x10
+		if err := (&BVol{}).UnmarshalBinary(corrupt); !errors.Is(err, ErrEncoding) {
+			t.Errorf("Flipping byte %d returned %v, expected ErrEncoding\n", index,
+				err)
+		}
+	}
+	for length := range data {
+		if err := (&BVol{}).UnmarshalBinary(data[:length]); !errors.Is(err,
+			ErrEncoding) {
+			t.Errorf("Truncating to %d bytes returned %v, expected ErrEncoding\n",
+				length, err)
+		}
+	}
+}
+
+// Replaces the checksum at the end of data with one over the rest, so that
+// corruption reaches the checks of the hierarchy.
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+}
+
+// Encodes volumes as given, whether or not they form a valid hierarchy.
+func encodeNodes(nodes ...encodedNode) []byte {
+	buf := append([]byte(nil), encodingMagic[:]...)
+	buf = binary.LittleEndian.AppendUint16(buf, encodingVersion)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(DIMENSIONS))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(nodes)))
+	for _, n := range nodes {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n.depth))
+		for _, p := range n.vol.Point {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(p))
+		}
+		for _, d := range n.vol.Delta {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(d))
+		}
+		if n.depth == 0 {
+			buf = binary.LittleEndian.AppendUint64(buf, n.id)
+		}
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	// Flipping any byte under a valid checksum either fails a check or still
+	// gives a valid hierarchy, as when it changes an ID or stays within bounds.
+	data, _ := getIdealTree().MarshalBinary()
+	for index := range data[:len(data)-4] {
+		corrupt := append([]byte(nil), data...)
+		corrupt[index] ^= 0x10
+		decoded := &BVol{}
+		if err := decoded.UnmarshalBinary(resum(corrupt)); err == nil {
+			if err := decoded.Validate(); err != nil {
+				t.Errorf("Flipping byte %d decoded an invalid hierarchy: %v\n", index,
+					err)
+			}
+		} else if !errors.Is(err, ErrEncoding) {
+			t.Errorf("Flipping byte %d returned %v, expected ErrEncoding\n", index,
+				err)
+		}
+	}
+
+	small := Orthotope{Point: [d]int32{1, 1, 1}, Delta: [d]int32{1, 1, 1}}
+	large := Orthotope{Point: [d]int32{0, 0, 0}, Delta: [d]int32{4, 4, 4}}
+	leaf := encodedNode{vol: small}
+	for _, test := range []struct {
+		name     string
+		nodes    []encodedNode
+		expected string
+	}{
+		{"too deep", []encodedNode{{depth: maxEncodedDepth, vol: large}},
+			"volume 0 has depth 64"},
+		{"negative depth", []encodedNode{{depth: -1, vol: large}},
+			"volume 0 has depth -1"},
+		{"wrong depth", []encodedNode{{depth: 2, vol: large}, leaf, leaf},
+			"volume 0 has depth 2 over children of 0 and 0"},
+		{"unbalanced", []encodedNode{{depth: 3, vol: large}, leaf,
+			{depth: 2, vol: large}, {depth: 1, vol: large}, leaf, leaf, leaf},
+			"volume 0 has depth 3 over children of 0 and 2"},
+		{"uncontained", []encodedNode{{depth: 1, vol: small}, leaf,
+			{vol: large}}, "volume 0 does not contain its children"},
+		{"missing", []encodedNode{{depth: 1, vol: large}, leaf},
+			"missing volumes"},
+		{"trailing", []encodedNode{leaf, leaf}, "1 volumes outside the hierarchy"},
+	} {
+		err := (&BVol{}).UnmarshalBinary(encodeNodes(test.nodes...))
+		if !errors.Is(err, ErrEncoding) || !strings.Contains(err.Error(),
+			test.expected) {
+			t.Errorf("Decoding %s volumes returned %v, expected %q\n", test.name,
+				err, test.expected)
+		}
+	}
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	// Inputs are checksummed before decoding, so that mutations reach past the
+	// checksum to the checks of the hierarchy.
+	for _, tree := range []*BVol{{}, getIdealTree(), TopDownBVH(randOrths(59, 20))} {
+		data, _ := tree.MarshalBinary()
+		f.Add(data[:len(data)-4])
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		data := binary.LittleEndian.AppendUint32(append([]byte(nil), body...),
+			crc32.ChecksumIEEE(body))
+		ids := map[*Orthotope]uint64{}
+		decoded, err := Decode(bytes.NewReader(data),
+			func(id uint64, bounds Orthotope) *Orthotope {
+				orth := &bounds
+				ids[orth] = id
+				return orth
+			})
+		if err != nil {
+			return
+		}
+		if err := decoded.Validate(); err != nil {
+			t.Errorf("Decoded an invalid hierarchy: %v\n", err)
+		}
+		// Anything accepted must encode back to the same bytes.
+		buf := &bytes.Buffer{}
+		decoded.Encode(buf, func(orth *Orthotope) uint64 {
+			return ids[orth]
+		})
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("Decoded input does not encode back to itself\n")
+		}
+	})
+}
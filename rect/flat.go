@@ -0,0 +1,134 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"iter"
+)
+
+// A FlatBVol is a read-only copy of a BVol stored as one depth-first array.
+// The first child of a volume directly follows it, and each volume records
+// the index just past its subtree and the index of its parent, so traversals
+// walk memory mostly forward and keep no stack: they allocate nothing, use
+// constant memory whatever the depth, and may be nested or run by many
+// goroutines at once.
+type FlatBVol struct {
+	nodes []flatNode
+}
+
+// A node holds a copy of its bounds, the index following its subtree, the index
+// of its parent, or -1 for the root, and, for leaves, the orthotope. The second
+// child of a volume at i is at nodes[i+1].skip.
+type flatNode struct {
+	vol    Orthotope
+	skip   int32
+	parent int32
+	leaf   *Orthotope
+}
+
+// Compile copies the hierarchy into a FlatBVol. Changes to bvol afterwards are
+// not reflected.
+func (bvol *BVol) Compile() *FlatBVol {
+	f := &FlatBVol{}
+	if bvol.vol == nil {
+		return f
+	}
+	f.nodes = make([]flatNode, 0, 2*bvol.Len()-1)
+	f.compile(bvol, -1)
+	return f
+}
+
+// Appends the volume and its subtree in pre-order.
+func (f *FlatBVol) compile(bvol *BVol, parent int32) {
+	index := len(f.nodes)
+	f.nodes = append(f.nodes, flatNode{vol: *bvol.vol, parent: parent})
+	if bvol.depth == 0 {
+		f.nodes[index].leaf = bvol.vol
+	} else {
+		f.compile(bvol.desc[0], int32(index))
+		f.compile(bvol.desc[1], int32(index))
+	}
+	f.nodes[index].skip = int32(len(f.nodes))
+}
+
+// Query returns a sequence of the orthotopes that overlap o. Volumes that do
+// not overlap o are jumped over by their skip index, so no stack is needed.
+func (f *FlatBVol) Query(o *Orthotope) iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		for i := int32(0); i < int32(len(f.nodes)); {
+			node := &f.nodes[i]
+			if !node.vol.Overlaps(o) {
+				i = node.skip
+				continue
+			}
+			if node.leaf != nil && !yield(node.leaf) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// Trace returns a sequence of the orthotopes intersected by the vector o along
+// with their distances, nearest branches first. Finished branches are left
+// through parent indices, intersecting o again with each volume passed and its
+// sibling to find whether the sibling remains to be visited.
+func (f *FlatBVol) Trace(o *Orthotope) iter.Seq2[*Orthotope, int32] {
+	return func(yield func(*Orthotope, int32) bool) {
+		if len(f.nodes) == 0 {
+			return
+		}
+		index := int32(0)
+		distance := o.Intersects(&f.nodes[0].vol)
+		if distance < 0 {
+			return
+		}
+		for {
+			node := &f.nodes[index]
+			if node.leaf == nil {
+				if near, nearT := f.traceNear(o, index); near >= 0 {
+					index, distance = near, nearT
+					continue
+				}
+			} else if !yield(node.leaf, distance) {
+				return
+			}
+
+			// Back up to the first volume visited before a sibling o intersects.
+			for {
+				parent := f.nodes[index].parent
+				if parent < 0 {
+					return
+				}
+				first, second := parent+1, f.nodes[parent+1].skip
+				sibling := first
+				if index == first {
+					sibling = second
+				}
+				if siblingT := o.Intersects(&f.nodes[sibling].vol); siblingT >= 0 {
+					// As in traceNear, the second child is nearer on a tie.
+					ownT := o.Intersects(&f.nodes[index].vol)
+					if siblingT > ownT || (siblingT == ownT && index == second) {
+						index, distance = sibling, siblingT
+						break
+					}
+				}
+				index = parent
+			}
+		}
+	}
+}
+
+// Returns the nearest child of a volume that o intersects and its distance, or
+// -1 if o misses both. On a tie, the second child is nearer.
+func (f *FlatBVol) traceNear(o *Orthotope, index int32) (int32, int32) {
+	first, second := index+1, f.nodes[index+1].skip
+	firstT := o.Intersects(&f.nodes[first].vol)
+	secondT := o.Intersects(&f.nodes[second].vol)
+	if secondT >= 0 && (firstT < 0 || secondT <= firstT) {
+		return second, secondT
+	}
+	if firstT >= 0 {
+		return first, firstT
+	}
+	return -1, -1
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tree := TopDownBVH(randOrths(39, 3000))
+	flat := tree.Compile()
+	nodes := 0
+	for range tree.Nodes() {
+		nodes++
+	}
+	if len(flat.nodes) != nodes {
+		t.Errorf("Compiled %d volumes, expected %d\n", len(flat.nodes), nodes)
+	}
+	for _, q := range randOrths(40, 200) {
+		if !sameSet(collect(flat.Query(q)), collect(tree.Query(q))) {
+			t.Errorf("Flat query %v differs from the binary tree\n", q.String())
+		}
+	}
+	for _, ray := range randOrths(41, 100) {
+		if !sameSet(collectTrace(t, ray, flat.Trace(ray)),
+			collectTrace(t, ray, tree.Trace(ray))) {
+			t.Errorf("Flat trace %v differs from the binary tree\n", ray.String())
+		}
+	}
+}
+
+func TestCompileSmall(t *testing.T) {
+	for range (&BVol{}).Compile().Query(leaf[0]) {
+		t.Errorf("Querying an empty flat hierarchy returned a volume\n")
+	}
+	single := &BVol{}
+	single.Add(leaf[0])
+	flat := single.Compile()
+	if !sameSet(collect(flat.Query(leaf[0])), map[*Orthotope]bool{leaf[0]: true}) {
+		t.Errorf("Querying a single leaf did not return it\n")
+	}
+	hit := &Orthotope{Point: [d]int32{-2, 0}, Delta: [d]int32{4, 2}}
+	for r, dist := range flat.Trace(hit) {
+		if r != leaf[0] || dist <= 0 {
+			t.Errorf("Tracing a single leaf returned %v at %d\n", r.String(), dist)
+		}
+	}
+}
+
+func TestFlatTraceOrder(t *testing.T) {
+	flat := getIdealTree().Compile()
+	q := &Orthotope{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}}
+	results := []*Orthotope{leaf[7], leaf[3], leaf[2]}
+	for r := range flat.Trace(q) {
+		if len(results) > 0 && results[0] == r {
+			results = results[1:]
+		} else {
+			t.Errorf("Tracing %v returned unexpected or out of order value: %v\n",
+				q.String(), r.String())
+		}
+	}
+	for _, orth := range results {
+		t.Errorf("Tracing %v did not return %v\n", q.String(), orth.String())
+	}
+}
+
+func TestFlatNested(t *testing.T) {
+	flat := getIdealTree().Compile()
+	all := &Orthotope{Point: [d]int32{-2, -2}, Delta: [d]int32{30, 30}}
+	q := &Orthotope{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}}
+	pairs := 0
+	for range flat.Query(all) {
+		for range flat.Trace(q) {
+			for range flat.Query(all) {
+				pairs++
+			}
+		}
+	}
+	if expected := 3 * len(leaf) * len(leaf); pairs != expected {
+		t.Errorf("Nested traversals returned %d values, expected %d\n", pairs,
+			expected)
+	}
+}
+
+func TestFlatDeep(t *testing.T) {
+	// Traversals keep no stack, so they reach leaves at any depth.
+	const depth = 200
+	bounds := &Orthotope{Delta: [d]int32{depth, 1}}
+	tree := &BVol{vol: &Orthotope{Point: [d]int32{depth - 1, 0},
+		Delta: [d]int32{1, 1}}}
+	for index := depth - 2; index >= 0; index-- {
+		tree = &BVol{vol: bounds, depth: tree.depth + 1, count: tree.leaves() + 1,
+			desc: [2]*BVol{
+				{vol: &Orthotope{Point: [d]int32{int32(index), 0}, Delta: [d]int32{1, 1}}},
+				tree}}
+	}
+	flat := tree.Compile()
+	ray := &Orthotope{Point: [d]int32{-1, 0}, Delta: [d]int32{depth + 1, 0}}
+	traced := 0
+	for range flat.Trace(ray) {
+		traced++
+	}
+	queried := 0
+	for range flat.Query(bounds) {
+		queried++
+	}
+	if traced != depth || queried != depth {
+		t.Errorf("Traced %d and queried %d leaves, expected %d\n", traced, queried,
+			depth)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for range flat.Trace(ray) {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Deep trace allocated %v times, expected none\n", allocs)
+	}
+}
+
+func TestFlatAllocs(t *testing.T) {
+	flat := TopDownBVH(randOrths(42, 3000)).Compile()
+	q := randOrths(43, 1)[0]
+	allocs := testing.AllocsPerRun(100, func() {
+		for range flat.Query(q) {
+		}
+		for range flat.Trace(q) {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Flat traversal allocated %v times, expected none\n", allocs)
+	}
+}
+
+func BenchmarkFlatQuery(b *testing.B) {
+	tree := TopDownBVH(randOrths(44, 50000))
+	flat := tree.Compile()
+	queries := randOrths(45, 1000)
+	b.Run("binary", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range tree.Query(queries[n%len(queries)]) {
+			}
+		}
+	})
+	b.Run("flat", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range flat.Query(queries[n%len(queries)]) {
+			}
+		}
+	})
+}
+
+func BenchmarkFlatTrace(b *testing.B) {
+	tree := TopDownBVH(randOrths(46, 50000))
+	flat := tree.Compile()
+	rays := randOrths(47, 1000)
+	b.Run("binary", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range tree.Trace(rays[n%len(rays)]) {
+				break
+			}
+		}
+	})
+	b.Run("flat", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range flat.Trace(rays[n%len(rays)]) {
+				break
+			}
+		}
+	})
+}
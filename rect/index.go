@@ -0,0 +1,245 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// An Index is a read-only hierarchy queried in place from its on-disk form,
+// typically a memory mapped file, so that it need not fit on the Go heap. It
+// holds IDs rather than orthotopes.
+//
+// The file is little endian: the magic, the version, DIMENSIONS and the number
+// of volumes, followed by fixed size records for each volume in the depth-first
+// order of a FlatBVol. Each record is the Point and Delta, the index following
+// the volume's subtree, 1 for leaves or 0 otherwise, and the leaf's ID.
+type Index struct {
+	data  []byte
+	count int
+	close func() error
+}
+
+var indexMagic = [4]byte{'B', 'V', 'I', 'X'}
+
+const indexVersion uint16 = 1
+
+const indexHeaderSize = 16
+const indexRecordSize = 8*DIMENSIONS + 16
+
+// WriteIndex builds a hierarchy top down over orths and writes it to w as an
+// Index, where ids[i] identifies orths[i].
+func (b Builder) WriteIndex(w io.Writer, orths []*Orthotope, ids []uint64) error {
+	if len(orths) != len(ids) {
+		return fmt.Errorf("rect: %d orthotopes but %d IDs", len(orths), len(ids))
+	}
+	// Copies tell apart any orthotope given more than once.
+	copies := make([]Orthotope, len(orths))
+	leaves := make([]*Orthotope, len(orths))
+	byLeaf := make(map[*Orthotope]uint64, len(orths))
+	for index, orth := range orths {
+		copies[index] = *orth
+		leaves[index] = &copies[index]
+		byLeaf[leaves[index]] = ids[index]
+	}
+	flat := b.TopDown(leaves).Compile()
+
+	out := bufio.NewWriter(w)
+	header := append([]byte(nil), indexMagic[:]...)
+	header = binary.LittleEndian.AppendUint16(header, indexVersion)
+	header = binary.LittleEndian.AppendUint16(header, uint16(DIMENSIONS))
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(flat.nodes)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	record := make([]byte, 0, indexRecordSize)
+	for _, n := range flat.nodes {
+		record = record[:0]
+		for _, p := range n.vol.Point {
+			record = binary.LittleEndian.AppendUint32(record, uint32(p))
+		}
+		for _, d := range n.vol.Delta {
+			record = binary.LittleEndian.AppendUint32(record, uint32(d))
+		}
+		record = binary.LittleEndian.AppendUint32(record, uint32(n.skip))
+		if n.leaf != nil {
+			record = binary.LittleEndian.AppendUint32(record, 1)
+			record = binary.LittleEndian.AppendUint64(record, byLeaf[n.leaf])
+		} else {
+			record = binary.LittleEndian.AppendUint32(record, 0)
+			record = binary.LittleEndian.AppendUint64(record, 0)
+		}
+		if _, err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// NewIndex reads an Index from data without copying it. data must not change
+// while the Index is in use.
+func NewIndex(data []byte) (*Index, error) {
+	if len(data) < indexHeaderSize || !bytes.Equal(data[:4], indexMagic[:]) {
+		return nil, fmt.Errorf("rect: missing index header")
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != indexVersion {
+		return nil, fmt.Errorf("rect: unsupported index version %d", v)
+	}
+	if dims := binary.LittleEndian.Uint16(data[6:]); int(dims) != DIMENSIONS {
+		return nil, fmt.Errorf("rect: index has %d dimensions, expected %d", dims,
+			DIMENSIONS)
+	}
+	count := binary.LittleEndian.Uint64(data[8:])
+	records := len(data) - indexHeaderSize
+	if records%indexRecordSize != 0 || count != uint64(records/indexRecordSize) {
+		return nil, fmt.Errorf("rect: index of %d bytes cannot hold %d volumes",
+			len(data), count)
+	}
+	return &Index{data: data, count: int(count)}, nil
+}
+
+// Close releases the file behind an Index opened by OpenIndex.
+func (x *Index) Close() error {
+	if x.close == nil {
+		return nil
+	}
+	err := x.close()
+	x.data, x.count, x.close = nil, 0, nil
+	return err
+}
+
+// Len returns the number of volumes, internal and leaf, in the index.
+func (x *Index) Len() int {
+	return x.count
+}
+
+// A volume read from its record.
+type indexNode struct {
+	vol  Orthotope
+	skip int
+	leaf bool
+	id   uint64
+}
+
+// Reads the volume at i. A corrupt skip that would not move forward, or would
+// pass the end, is clamped to the end so that traversals always finish.
+func (x *Index) node(i int) indexNode {
+	record := x.data[indexHeaderSize+i*indexRecordSize:]
+	n := indexNode{}
+	for index := 0; index < DIMENSIONS; index++ {
+		n.vol.Point[index] = int32(binary.LittleEndian.Uint32(record[4*index:]))
+		n.vol.Delta[index] = int32(binary.LittleEndian.Uint32(
+			record[4*(DIMENSIONS+index):]))
+	}
+	record = record[8*DIMENSIONS:]
+	n.skip = int(binary.LittleEndian.Uint32(record))
+	if n.skip <= i || n.skip > x.count {
+		n.skip = x.count
+	}
+	n.leaf = binary.LittleEndian.Uint32(record[4:]) != 0
+	n.id = binary.LittleEndian.Uint64(record[8:])
+	return n
+}
+
+// Query returns a sequence of the IDs of the orthotopes that overlap o.
+func (x *Index) Query(o *Orthotope) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for i := 0; i < x.count; {
+			n := x.node(i)
+			if !n.vol.Overlaps(o) {
+				i = n.skip
+				continue
+			}
+			if n.leaf && !yield(n.id) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// QueryPoint returns a sequence of the IDs of the orthotopes containing point.
+func (x *Index) QueryPoint(point [DIMENSIONS]int32) iter.Seq[uint64] {
+	return x.Query(&Orthotope{Point: point})
+}
+
+// A volume waiting to be visited, by its squared distance from a point.
+type indexDistance struct {
+	index    int
+	distance uint64
+}
+
+type byDistance []indexDistance
+
+func (d byDistance) Len() int           { return len(d) }
+func (d byDistance) Less(i, j int) bool { return d[i].distance < d[j].distance }
+func (d byDistance) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d *byDistance) Push(x any)        { *d = append(*d, x.(indexDistance)) }
+func (d *byDistance) Pop() any {
+	old := *d
+	last := old[len(old)-1]
+	*d = old[:len(old)-1]
+	return last
+}
+
+// Nearest returns a sequence of the IDs of the orthotopes nearest to point,
+// with their squared euclidean distances, nearest first. Orthotopes containing
+// point are at distance 0. Stop the loop after as many as are needed.
+func (x *Index) Nearest(point [DIMENSIONS]int32) iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		if x.count == 0 {
+			return
+		}
+		root := x.node(0)
+		queue := &byDistance{{index: 0, distance: pointDistance(point, &root.vol)}}
+		for queue.Len() > 0 {
+			next := heap.Pop(queue).(indexDistance)
+			n := x.node(next.index)
+			if n.leaf {
+				if !yield(n.id, next.distance) {
+					return
+				}
+				continue
+			}
+			first := next.index + 1
+			if first >= n.skip {
+				continue
+			}
+			second := x.node(first).skip
+			for _, child := range [2]int{first, second} {
+				if child < n.skip {
+					c := x.node(child)
+					heap.Push(queue, indexDistance{index: child,
+						distance: pointDistance(point, &c.vol)})
+				}
+			}
+		}
+	}
+}
+
+// Squared euclidean distance from point to the nearest point of o, saturating
+// rather than overflowing.
+func pointDistance(point [DIMENSIONS]int32, o *Orthotope) uint64 {
+	distance := uint64(0)
+	for index, p := range point {
+		low := int64(o.Point[index])
+		high := low + int64(o.Delta[index])
+		gap := uint64(0)
+		if int64(p) < low {
+			gap = uint64(low - int64(p))
+		} else if int64(p) > high {
+			gap = uint64(int64(p) - high)
+		}
+		square := gap * gap
+		if distance+square < distance {
+			return ^uint64(0)
+		}
+		distance += square
+	}
+	return distance
+}
@@ -0,0 +1,19 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+
+//go:build !unix
+
+package rect
+
+import (
+	"os"
+)
+
+// OpenIndex reads the index file at path. Without memory mapping on this
+// platform, the whole file is read onto the heap.
+func OpenIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(data)
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes an index of orths, identifying each by its position plus 100.
+func writeIndex(t *testing.T, orths []*Orthotope) string {
+	ids := make([]uint64, len(orths))
+	for index := range orths {
+		ids[index] = uint64(index) + 100
+	}
+	path := filepath.Join(t.TempDir(), "index")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Unable to create %s: %v\n", path, err)
+	}
+	defer file.Close()
+	if err := (Builder{}).WriteIndex(file, orths, ids); err != nil {
+		t.Fatalf("Unable to write index: %v\n", err)
+	}
+	return path
+}
+
+func TestIndexQuery(t *testing.T) {
+	orths := randOrths(60, 2000)
+	x, err := OpenIndex(writeIndex(t, orths))
+	if err != nil {
+		t.Fatalf("Unable to open index: %v\n", err)
+	}
+	defer x.Close()
+	if x.Len() != 2*len(orths)-1 {
+		t.Errorf("Index holds %d volumes, expected %d\n", x.Len(), 2*len(orths)-1)
+	}
+
+	for _, q := range randOrths(61, 100) {
+		expected := map[uint64]bool{}
+		for index, orth := range orths {
+			if orth.Overlaps(q) {
+				expected[uint64(index)+100] = true
+			}
+		}
+		found := map[uint64]bool{}
+		for id := range x.Query(q) {
+			found[id] = true
+		}
+		if len(found) != len(expected) {
+			t.Errorf("Index query %v found %d IDs, expected %d\n", q.String(),
+				len(found), len(expected))
+		}
+		for id := range expected {
+			if !found[id] {
+				t.Errorf("Index query %v did not find %d\n", q.String(), id)
+			}
+		}
+	}
+
+	point := orths[7].Point
+	found := false
+	for id := range x.QueryPoint(point) {
+		found = found || id == 107
+	}
+	if !found {
+		t.Errorf("Point query %v did not find the orthotope at it\n", point)
+	}
+}
+
+func TestIndexNearest(t *testing.T) {
+	orths := randOrths(62, 1000)
+	x, err := OpenIndex(writeIndex(t, orths))
+	if err != nil {
+		t.Fatalf("Unable to open index: %v\n", err)
+	}
+	defer x.Close()
+
+	for _, p := range randOrths(63, 50) {
+		point := p.Point
+		// Compare the distances of the nearest ten against a brute force scan.
+		distances := make([]uint64, len(orths))
+		for index, orth := range orths {
+			distances[index] = pointDistance(point, orth)
+		}
+		count := 0
+		last := uint64(0)
+		for id, distance := range x.Nearest(point) {
+			if distance != distances[id-100] || distance < last {
+				t.Errorf("Nearest to %v returned %d at %d after %d\n", point, id,
+					distance, last)
+			}
+			closer := 0
+			for _, d := range distances {
+				if d < distance {
+					closer++
+				}
+			}
+			if closer > count {
+				t.Errorf("Nearest to %v skipped %d closer orthotopes\n", point,
+					closer-count)
+			}
+			last = distance
+			if count++; count == 10 {
+				break
+			}
+		}
+	}
+}
+
+func TestIndexInvalid(t *testing.T) {
+	if err := (Builder{}).WriteIndex(&bytes.Buffer{}, randOrths(64, 2),
+		[]uint64{1}); err == nil {
+		t.Errorf("Wrote an index with fewer IDs than orthotopes\n")
+	}
+
+	buf := &bytes.Buffer{}
+	(Builder{}).WriteIndex(buf, randOrths(65, 50), make([]uint64, 50))
+	data := buf.Bytes()
+	for _, bad := range [][]byte{nil, data[:10], data[:len(data)-1],
+		append([]byte("XXXX"), data[4:]...)} {
+		if _, err := NewIndex(bad); err == nil {
+			t.Errorf("Opened an invalid index of %d bytes\n", len(bad))
+		}
+	}
+
+	// Corrupt skips must not loop or read past the end.
+	corrupt := append([]byte(nil), data...)
+	for i := 0; i < 99; i++ {
+		skip := indexHeaderSize + i*indexRecordSize + 8*DIMENSIONS
+		corrupt[skip], corrupt[skip+1], corrupt[skip+2], corrupt[skip+3] = 0, 0, 0, 0
+	}
+	x, err := NewIndex(corrupt)
+	if err != nil {
+		t.Fatalf("Unable to open corrupt index: %v\n", err)
+	}
+	all := &Orthotope{Point: [d]int32{-1, -1, -1}, Delta: [d]int32{1200, 1200, 1200}}
+	for range x.Query(all) {
+	}
+	for range x.Nearest([d]int32{}) {
+	}
+
+	empty := &bytes.Buffer{}
+	(Builder{}).WriteIndex(empty, nil, nil)
+	x, err = NewIndex(empty.Bytes())
+	if err != nil || x.Len() != 0 {
+		t.Errorf("Unable to open an empty index: %v\n", err)
+	}
+	for range x.Nearest([d]int32{}) {
+		t.Errorf("Nearest in an empty index returned an ID\n")
+	}
+}
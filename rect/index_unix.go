@@ -0,0 +1,42 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+
+//go:build unix
+
+package rect
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenIndex memory maps the index file at path. Close the Index to unmap it.
+func OpenIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < indexHeaderSize || size != int64(int(size)) {
+		return nil, fmt.Errorf("rect: index file of %d bytes", size)
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ,
+		syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	x, err := NewIndex(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	x.close = func() error {
+		return syscall.Munmap(data)
+	}
+	return x, nil
+}
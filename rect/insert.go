@@ -0,0 +1,151 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Insertion selects how Add chooses where to place a new orthotope.
+type Insertion int
+
+const (
+	// GREEDY descends from the root into the child that grows the least.
+	GREEDY Insertion = iota
+	// BRANCH_AND_BOUND searches for the sibling that adds the least total cost
+	// to the hierarchy, pruning volumes with a lower bound as in Bittner et
+	// al., 2013 (https://doi.org/10.1145/2492045.2492055). To keep the
+	// hierarchy balanced, the sibling must be a leaf or a parent of leaves.
+	BRANCH_AND_BOUND
+)
+
+// SetInsertion sets how the hierarchy chooses where to add orthotopes,
+// whichever iterator adds them. Only set it on the root volume.
+func (bvol *BVol) SetInsertion(insertion Insertion) {
+	bvol.state().insertion = insertion
+}
+
+// Insertion returns how the hierarchy chooses where to add orthotopes.
+func (bvol *BVol) Insertion() Insertion {
+	if bvol.tree == nil {
+		return GREEDY
+	}
+	return bvol.tree.insertion
+}
+
+// SetInsertion sets the insertion of the BVH associated with this stack. See
+// BVol.SetInsertion.
+func (s *orthStack) SetInsertion(insertion Insertion) {
+	s.bvh.SetInsertion(insertion)
+}
+
+// A possible sibling for an added orthotope.
+type candidate struct {
+	bvol *BVol
+	// Index of the parent candidate and which of its children this is.
+	parent int
+	index  int32
+	// Cost added to the ancestors by the orthotope, and a lower bound on the
+	// cost of adding the orthotope beneath this volume.
+	inherited int64
+	bound     int64
+}
+
+// A min heap of candidates by their lower bound.
+type byBound []candidate
+
+func (h byBound) Len() int {
+	return len(h)
+}
+
+func (h byBound) Less(i, j int) bool {
+	return h[i].bound < h[j].bound
+}
+
+func (h byBound) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *byBound) Push(x any) {
+	*h = append(*h, x.(candidate))
+}
+
+func (h *byBound) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Adds an orthotope beside the volume that adds the least total cost, found
+// by a branch and bound search. The root must not be empty.
+func (s *orthStack) addBest(orth *Orthotope) bool {
+	if s.Contains(orth) {
+		return false
+	}
+	m := s.Metric()
+	comp := Orthotope{}
+	orthCost := m.Cost(orth)
+
+	visited := []candidate{}
+	best := -1
+	bestCost := int64(math.MaxInt64)
+	queue := &byBound{{bvol: s.bvh, parent: -1, bound: orthCost}}
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(candidate)
+		if c.bound >= bestCost {
+			// Every remaining candidate costs at least as much.
+			break
+		}
+		visited = append(visited, c)
+		comp.MinBounds(c.bvol.vol, orth)
+		cost := m.Cost(&comp)
+		if c.bvol.depth <= 1 && cost+c.inherited < bestCost {
+			best = len(visited) - 1
+			bestCost = cost + c.inherited
+		}
+		if c.bvol.depth > 0 {
+			inherited := c.inherited + cost - m.Cost(c.bvol.vol)
+			if bound := orthCost + inherited; bound < bestCost {
+				for index, child := range c.bvol.desc {
+					heap.Push(queue, candidate{bvol: child, parent: len(visited) - 1,
+						index: int32(index), inherited: inherited, bound: bound})
+				}
+			}
+		}
+	}
+
+	// Rebuild the path to the sibling on the stack.
+	path := []int{}
+	for i := best; i > 0; i = visited[i].parent {
+		path = append(path, i)
+	}
+	s.Reset()
+	for i := len(path) - 1; i >= 0; i-- {
+		c := visited[path[i]]
+		s.intStack[len(s.intStack)-1] = c.index
+		s.append(c.bvol, 0)
+	}
+	s.ownPath()
+
+	sibling, _ := s.peek()
+	if sibling.depth == 0 {
+		sibling.desc[0] = s.newLeaf(orth)
+		sibling.desc[1] = s.moveLeaf(sibling)
+		sibling.redepth()
+		vol := s.newVol()
+		*vol = *sibling.vol
+		sibling.vol = vol
+	} else {
+		// Move the parent of leaves down a level, following the deeper side.
+		moved := s.newNode(sibling.vol)
+		moved.desc, moved.depth, moved.count = sibling.desc, sibling.depth, sibling.count
+		sibling.vol = s.newVol()
+		sibling.desc = [2]*BVol{s.newLeaf(orth), moved}
+		sibling.redepth()
+		sibling.minBound()
+		s.intStack[len(s.intStack)-1] = 1
+	}
+	s.rebalanceAdd()
+	return true
+}
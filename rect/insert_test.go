@@ -0,0 +1,74 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestBranchAndBound(t *testing.T) {
+	for seed := int64(0); seed < 5; seed++ {
+		orths := randOrths(16+seed, 2000)
+		greedy := &BVol{}
+		greedyIter := greedy.Iterator()
+		greedyIter.SetMetric(AreaMetric{})
+		best := &BVol{}
+		bestIter := best.Iterator()
+		bestIter.SetMetric(AreaMetric{})
+		bestIter.SetInsertion(BRANCH_AND_BOUND)
+
+		for _, orth := range orths {
+			greedyIter.Add(orth)
+			if !bestIter.Add(orth) {
+				t.Errorf("Unable to add: %v\n", orth.String())
+			}
+		}
+		checkTree(t, best)
+		if best.SAH() >= greedy.SAH() {
+			t.Errorf("Branch and bound SAH %v is no better than greedy SAH %v\n",
+				best.SAH(), greedy.SAH())
+		}
+		for _, orth := range orths {
+			if !bestIter.Contains(orth) {
+				t.Errorf("Unable to find: %v\n", orth.String())
+			}
+		}
+		if bestIter.Add(orths[0]) {
+			t.Errorf("Incorrectly added existing volume: %v\n", orths[0].String())
+		}
+	}
+}
+
+func TestInsertionKept(t *testing.T) {
+	orths := randOrths(21, 500)
+	iterated := &BVol{}
+	iter := iterated.Iterator()
+	iter.SetInsertion(BRANCH_AND_BOUND)
+	for _, orth := range orths {
+		iter.Add(orth)
+	}
+
+	// Every way of adding to a hierarchy uses its insertion.
+	added := &BVol{}
+	added.Iterator().SetInsertion(BRANCH_AND_BOUND)
+	for _, orth := range orths {
+		added.Add(orth)
+	}
+	synced := Builder{Insertion: BRANCH_AND_BOUND}.TopDown(nil)
+	wrapped := NewSyncBVol(synced)
+	for _, orth := range orths {
+		wrapped.Add(orth)
+	}
+	batched := &BVol{}
+	batched.SetInsertion(BRANCH_AND_BOUND)
+	batched.AddAll(orths)
+	for name, tree := range map[string]*BVol{"BVol.Add": added,
+		"SyncBVol.Add": synced, "AddAll": batched} {
+		if !tree.Equals(iterated) {
+			t.Errorf("Adding through %s did not use branch and bound\n", name)
+		}
+	}
+	if clone := added.Clone(false); clone.Insertion() != BRANCH_AND_BOUND {
+		t.Errorf("Clone uses insertion %v, expected BRANCH_AND_BOUND\n",
+			clone.Insertion())
+	}
+}
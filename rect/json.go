@@ -0,0 +1,135 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The JSON form of a volume. Leaves have an ID and internal volumes two
+// Children. An empty hierarchy is null.
+type jsonNode struct {
+	Depth    int32
+	Point    [DIMENSIONS]int32
+	Delta    [DIMENSIONS]int32
+	ID       uint64      `json:",omitempty"`
+	Children []*jsonNode `json:",omitempty"`
+}
+
+// EncodeJSON writes the hierarchy to w as nested JSON, identifying each leaf
+// by id.
+func (bvol *BVol) EncodeJSON(w io.Writer, id func(*Orthotope) uint64) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(bvol.toJSON(id))
+}
+
+// MarshalJSON encodes the hierarchy, identifying each leaf by its index in
+// pre-order.
+func (bvol *BVol) MarshalJSON() ([]byte, error) {
+	ids := map[*Orthotope]uint64{}
+	for orth := range bvol.Leaves() {
+		ids[orth] = uint64(len(ids))
+	}
+	return json.Marshal(bvol.toJSON(func(orth *Orthotope) uint64 {
+		return ids[orth]
+	}))
+}
+
+func (bvol *BVol) toJSON(id func(*Orthotope) uint64) *jsonNode {
+	if bvol.vol == nil {
+		return nil
+	}
+	n := &jsonNode{Depth: bvol.depth, Point: bvol.vol.Point, Delta: bvol.vol.Delta}
+	if bvol.depth == 0 {
+		n.ID = id(bvol.vol)
+	} else {
+		n.Children = []*jsonNode{bvol.desc[0].toJSON(id), bvol.desc[1].toJSON(id)}
+	}
+	return n
+}
+
+// DecodeJSON reads a hierarchy written by EncodeJSON, checking it as Decode
+// does. leaf is called with the ID and bounds of each leaf and returns the
+// orthotope to hold, or nil to fail with ErrEncoding. A nil leaf allocates a
+// copy of the bounds instead.
+func DecodeJSON(r io.Reader, leaf func(id uint64, bounds Orthotope) *Orthotope) (*BVol, error) {
+	var root *jsonNode
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	return fromJSON(root, leaf)
+}
+
+// UnmarshalJSON replaces the hierarchy with one encoded by MarshalJSON or
+// EncodeJSON, holding newly allocated leaves.
+func (bvol *BVol) UnmarshalJSON(data []byte) error {
+	var root *jsonNode
+	if err := json.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	decoded, err := fromJSON(root, nil)
+	if err != nil {
+		return err
+	}
+	bvol.replace(decoded)
+	return nil
+}
+
+func fromJSON(root *jsonNode, leaf func(id uint64, bounds Orthotope) *Orthotope) (*BVol, error) {
+	bvol := &BVol{}
+	if root == nil {
+		return bvol, nil
+	}
+	nodes := []encodedNode{}
+	var flatten func(n *jsonNode) error
+	flatten = func(n *jsonNode) error {
+		if n == nil {
+			return fmt.Errorf("%w: null volume", ErrEncoding)
+		}
+		nodes = append(nodes, encodedNode{depth: n.Depth,
+			vol: Orthotope{Point: n.Point, Delta: n.Delta}, id: n.ID})
+		if (n.Depth == 0) != (len(n.Children) == 0) || (n.Depth != 0 &&
+			len(n.Children) != 2) {
+			return fmt.Errorf("%w: volume of depth %d with %d children", ErrEncoding,
+				n.Depth, len(n.Children))
+		}
+		for _, child := range n.Children {
+			if err := flatten(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := flatten(root); err != nil {
+		return nil, err
+	}
+	if _, err := checkEncoded(nodes, 0, maxEncodedDepth); err != nil {
+		return nil, err
+	}
+	if _, err := buildEncoded(bvol, nodes, 0, leaf); err != nil {
+		return nil, err
+	}
+	return bvol, nil
+}
+
+// WriteOrthotopes writes orths to w as a JSON list.
+func WriteOrthotopes(w io.Writer, orths []*Orthotope) error {
+	return json.NewEncoder(w).Encode(orths)
+}
+
+// ReadOrthotopes reads a JSON list of orthotopes, such as one written by
+// WriteOrthotopes.
+func ReadOrthotopes(r io.Reader) ([]*Orthotope, error) {
+	orths := []*Orthotope{}
+	if err := json.NewDecoder(r).Decode(&orths); err != nil {
+		return nil, err
+	}
+	for index, orth := range orths {
+		if orth == nil {
+			return nil, fmt.Errorf("rect: null orthotope at %d", index)
+		}
+	}
+	return orths, nil
+}
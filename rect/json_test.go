@@ -0,0 +1,106 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	for _, tree := range []*BVol{{}, getIdealTree(), TopDownBVH(randOrths(66, 500))} {
+		data, err := json.Marshal(tree)
+		if err != nil {
+			t.Errorf("Unable to marshal: %v\n", err)
+		}
+		decoded := &BVol{}
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Errorf("Unable to unmarshal: %v\n", err)
+		}
+		if !sameTree(tree, decoded) {
+			t.Errorf("Unmarshaled hierarchy differs from the original\n")
+		}
+	}
+}
+
+func TestEncodeJSONIDs(t *testing.T) {
+	ids := map[*Orthotope]uint64{}
+	for index, orth := range leaf {
+		ids[orth] = uint64(index) + 1
+	}
+	tree := getIdealTree()
+	buf := &bytes.Buffer{}
+	if err := tree.EncodeJSON(buf, func(orth *Orthotope) uint64 {
+		return ids[orth]
+	}); err != nil {
+		t.Errorf("Unable to encode: %v\n", err)
+	}
+	decoded, err := DecodeJSON(buf, func(id uint64, bounds Orthotope) *Orthotope {
+		return leaf[id-1]
+	})
+	if err != nil {
+		t.Errorf("Unable to decode: %v\n", err)
+	}
+	if !sameTree(tree, decoded) {
+		t.Errorf("Decoded hierarchy differs from the original\n")
+	}
+	for _, orth := range leaf {
+		if !decoded.Iterator().Contains(orth) {
+			t.Errorf("Decoded hierarchy does not hold %v\n", orth.String())
+		}
+	}
+
+	data, _ := tree.MarshalJSON()
+	decoded, err = DecodeJSON(bytes.NewReader(data), func(id uint64,
+		bounds Orthotope) *Orthotope {
+		return nil
+	})
+	if decoded != nil || !errors.Is(err, ErrEncoding) {
+		t.Errorf("Decoded nil leaves with error %v\n", err)
+	}
+}
+
+func TestDecodeJSONInvalid(t *testing.T) {
+	invalid := []string{
+		`{"Depth":1,"Point":[0,0,0],"Delta":[5,5,5]}`,
+		`{"Depth":0,"Point":[0,0,0],"Delta":[5,5,5],"Children":[null,null]}`,
+		`{"Depth":1,"Point":[0,0,0],"Delta":[5,5,5],"Children":[null,null]}`,
+		`{"Depth":2,"Point":[0,0,0],"Delta":[5,5,5],"Children":[
+			{"Depth":0,"Point":[0,0,0],"Delta":[1,1,1]},
+			{"Depth":0,"Point":[1,1,1],"Delta":[1,1,1]}]}`,
+		`{"Depth":1,"Point":[0,0,0],"Delta":[5,5,5],"Children":[
+			{"Depth":0,"Point":[0,0,0],"Delta":[1,1,1]},
+			{"Depth":0,"Point":[4,4,4],"Delta":[9,1,1]}]}`,
+	}
+	for _, doc := range invalid {
+		if _, err := DecodeJSON(strings.NewReader(doc), nil); !errors.Is(err,
+			ErrEncoding) {
+			t.Errorf("Decoding %s returned %v, expected ErrEncoding\n", doc, err)
+		}
+	}
+	if _, err := DecodeJSON(strings.NewReader(`{"Depth":`), nil); err == nil {
+		t.Errorf("Decoded truncated JSON\n")
+	}
+}
+
+func TestOrthotopesJSON(t *testing.T) {
+	orths := randOrths(67, 100)
+	buf := &bytes.Buffer{}
+	if err := WriteOrthotopes(buf, orths); err != nil {
+		t.Errorf("Unable to write orthotopes: %v\n", err)
+	}
+	read, err := ReadOrthotopes(buf)
+	if err != nil || len(read) != len(orths) {
+		t.Fatalf("Read %d orthotopes, expected %d: %v\n", len(read), len(orths), err)
+	}
+	for index, orth := range orths {
+		if !orth.Equals(read[index]) {
+			t.Errorf("Read %v, expected %v\n", read[index].String(), orth.String())
+		}
+	}
+	if _, err := ReadOrthotopes(strings.NewReader(`[null]`)); err == nil {
+		t.Errorf("Read a null orthotope\n")
+	}
+}
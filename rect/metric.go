@@ -0,0 +1,107 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+// A Metric scores bounding volumes when choosing where to insert orthotopes,
+// which volumes to swap when rotating and where to split when building.
+type Metric interface {
+	// Cost of a bounding volume. The hierarchy tries to minimize total cost.
+	Cost(o *Orthotope) int64
+	// Enlargement is the cost of growing the volume child to hold orth, given
+	// the sibling of child.
+	Enlargement(child *Orthotope, sibling *Orthotope, orth *Orthotope) int64
+}
+
+// ScoreMetric costs volumes by the sum of their extents, as Orthotope.Score
+// does. This is half the perimeter in two dimensions and is the default.
+type ScoreMetric struct{}
+
+// AreaMetric costs volumes by their surface area, as the SAH does.
+type AreaMetric struct{}
+
+// VolumeMetric costs volumes by their volume.
+type VolumeMetric struct{}
+
+// OverlapMetric costs volumes by their surface area, but inserts orthotopes
+// where they add the least overlap between siblings plus enlargement, both
+// measured by volume, in the style of an R*-tree.
+type OverlapMetric struct{}
+
+// The metric used when none is given.
+var defaultMetric Metric = ScoreMetric{}
+
+func (ScoreMetric) Cost(o *Orthotope) int64 {
+	score := int64(0)
+	for _, d := range o.Delta {
+		score += int64(d)
+	}
+	return score
+}
+
+func (m ScoreMetric) Enlargement(child *Orthotope, sibling *Orthotope, orth *Orthotope) int64 {
+	grown := grow(child, orth)
+	return m.Cost(&grown) - m.Cost(child)
+}
+
+func (AreaMetric) Cost(o *Orthotope) int64 {
+	area := int64(0)
+	for skip := 0; skip < DIMENSIONS; skip++ {
+		face := int64(1)
+		for index, delta := range o.Delta {
+			if index != skip {
+				face *= int64(delta)
+			}
+		}
+		area += face
+	}
+	return 2 * area
+}
+
+func (m AreaMetric) Enlargement(child *Orthotope, sibling *Orthotope, orth *Orthotope) int64 {
+	grown := grow(child, orth)
+	return m.Cost(&grown) - m.Cost(child)
+}
+
+func (VolumeMetric) Cost(o *Orthotope) int64 {
+	volume := int64(1)
+	for _, d := range o.Delta {
+		volume *= int64(d)
+	}
+	return volume
+}
+
+func (m VolumeMetric) Enlargement(child *Orthotope, sibling *Orthotope, orth *Orthotope) int64 {
+	grown := grow(child, orth)
+	return m.Cost(&grown) - m.Cost(child)
+}
+
+func (OverlapMetric) Cost(o *Orthotope) int64 {
+	return AreaMetric{}.Cost(o)
+}
+
+func (OverlapMetric) Enlargement(child *Orthotope, sibling *Orthotope, orth *Orthotope) int64 {
+	grown := grow(child, orth)
+	return overlap(&grown, sibling) - overlap(child, sibling) +
+		VolumeMetric{}.Enlargement(child, sibling, orth)
+}
+
+// Returns child grown to hold orth. Costing the result with a concrete metric,
+// rather than through the Metric interface, keeps it off the heap.
+func grow(child *Orthotope, orth *Orthotope) Orthotope {
+	grown := Orthotope{}
+	grown.MinBounds(child, orth)
+	return grown
+}
+
+// The volume shared by two orthotopes.
+func overlap(o *Orthotope, other *Orthotope) int64 {
+	volume := int64(1)
+	for index, p0 := range o.Point {
+		low := max(p0, other.Point[index])
+		high := min(p0+o.Delta[index], other.Point[index]+other.Delta[index])
+		if high <= low {
+			return 0
+		}
+		volume *= int64(high - low)
+	}
+	return volume
+}
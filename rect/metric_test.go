@@ -0,0 +1,128 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMetricCost(t *testing.T) {
+	o := &Orthotope{Point: [d]int32{1, 2, 3}, Delta: [d]int32{30, 15, 2}}
+	configs := []struct {
+		m    Metric
+		want int64
+	}{
+		{ScoreMetric{}, 47},
+		{AreaMetric{}, 2 * (30*15 + 15*2 + 30*2)},
+		{VolumeMetric{}, 900},
+		{OverlapMetric{}, 2 * (30*15 + 15*2 + 30*2)},
+	}
+	for _, c := range configs {
+		if got := c.m.Cost(o); got != c.want {
+			t.Errorf("%T: expected %v, got %v.", c.m, c.want, got)
+		}
+	}
+}
+
+func TestMetricEnlargement(t *testing.T) {
+	child := &Orthotope{Point: [d]int32{0, 0, 0}, Delta: [d]int32{10, 10, 10}}
+	sibling := &Orthotope{Point: [d]int32{12, 0, 0}, Delta: [d]int32{10, 10, 10}}
+	orth := &Orthotope{Point: [d]int32{10, 0, 0}, Delta: [d]int32{4, 10, 10}}
+
+	configs := []struct {
+		m    Metric
+		want int64
+	}{
+		{ScoreMetric{}, 4},
+		{AreaMetric{}, 2 * 4 * 20},
+		{VolumeMetric{}, 400},
+		// Growing child to [0, 14] overlaps the sibling by 2 * 10 * 10.
+		{OverlapMetric{}, 200 + 400},
+	}
+	for _, c := range configs {
+		if got := c.m.Enlargement(child, sibling, orth); got != c.want {
+			t.Errorf("%T: expected %v, got %v.", c.m, c.want, got)
+		}
+	}
+}
+
+func TestMetricTrees(t *testing.T) {
+	orths := randOrths(15, 1000)
+	for _, m := range []Metric{ScoreMetric{}, AreaMetric{}, VolumeMetric{}, OverlapMetric{}} {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			tree := &BVol{}
+			iter := tree.Iterator()
+			iter.SetMetric(m)
+			for _, orth := range orths[:600] {
+				iter.Add(orth)
+			}
+			for _, orth := range orths[:300] {
+				iter.Remove(orth)
+			}
+			iter.AddAll(orths[600:])
+			checkTree(t, tree)
+
+			built := Builder{Metric: m}.TopDown(append([]*Orthotope{}, orths...))
+			checkTree(t, built)
+			for _, orth := range orths[300:] {
+				if !iter.Contains(orth) || !built.Iterator().Contains(orth) {
+					t.Errorf("Unable to find: %v\n", orth.String())
+				}
+			}
+			t.Logf("Online SAH %v, top down SAH %v", tree.SAH(), built.SAH())
+		})
+	}
+}
+
+// Counts the enlargements it scores, to show which metric a hierarchy uses.
+type countingMetric struct {
+	AreaMetric
+	count *int
+}
+
+func (m countingMetric) Enlargement(child *Orthotope, sibling *Orthotope,
+	orth *Orthotope) int64 {
+	*m.count++
+	return m.AreaMetric.Enlargement(child, sibling, orth)
+}
+
+func TestMetricKept(t *testing.T) {
+	count := 0
+	m := countingMetric{count: &count}
+	orths := randOrths(16, 100)
+	tree := &BVol{}
+	tree.Iterator().SetMetric(m)
+	if tree.Iterator().Metric() != m {
+		t.Errorf("A new iterator uses %T, expected the metric set\n",
+			tree.Iterator().Metric())
+	}
+	for _, orth := range orths[:50] {
+		tree.Add(orth)
+	}
+	if count == 0 {
+		t.Errorf("BVol.Add did not use the metric of the hierarchy\n")
+	}
+	count = 0
+	NewSyncBVol(tree).Add(orths[50])
+	if count == 0 {
+		t.Errorf("SyncBVol.Add did not use the metric of the hierarchy\n")
+	}
+
+	built := Builder{Metric: m}.TopDown(append([]*Orthotope{}, orths[51:]...))
+	snapshot, _ := tree.CopyRemove(orths[0])
+	for name, derived := range map[string]*BVol{
+		"built":     built,
+		"clone":     tree.Clone(false),
+		"snapshot":  snapshot,
+		"extracted": tree.Extract(tree.Bounds()),
+	} {
+		if derived.Metric() != m {
+			t.Errorf("The %s hierarchy uses %T, expected the metric set\n", name,
+				derived.Metric())
+		}
+	}
+	if (&BVol{}).Metric() != defaultMetric {
+		t.Errorf("A new hierarchy uses %T, expected %T\n", (&BVol{}).Metric(),
+			defaultMetric)
+	}
+}
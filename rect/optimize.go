@@ -0,0 +1,143 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"container/heap"
+
+	disc "github.com/briannoyama/bvh/discreet"
+)
+
+// Optimize spends up to budget volume visits improving the SAH of the
+// hierarchy through tree rotations, and returns the number of rotations made.
+// Volumes are visited largest surface area first, since they contribute the
+// most to the SAH. The hierarchy keeps the volumes it has yet to visit between
+// calls, so each call continues where the last stopped, and a new pass starts
+// from the root once all have been visited. Each visit takes constant time, so
+// a game may call Optimize with a fixed budget every frame. Any other update
+// to the hierarchy starts a new pass.
+func (bvol *BVol) Optimize(budget int) int {
+	return bvol.Iterator().Optimize(budget)
+}
+
+// Optimize the BVH associated with this stack. See BVol.Optimize.
+func (s *orthStack) Optimize(budget int) int {
+	rotations := 0
+	if s.bvh.depth < 2 {
+		return rotations
+	}
+	queue := &s.bvh.state().optimizing
+	for ; budget > 0; budget-- {
+		if queue.Len() == 0 {
+			heap.Push(queue, s.bvh)
+		}
+		bvol := heap.Pop(queue).(*BVol)
+		if bvol.rotate() {
+			rotations++
+		}
+		for _, child := range bvol.desc {
+			// Rotations need at least grandchildren to swap.
+			if child.depth > 1 {
+				heap.Push(queue, child)
+			}
+		}
+	}
+	return rotations
+}
+
+// Tries swapping each child of a volume with each grandchild on the other side,
+// and each pair of grandchildren across sides, keeping the swap that most
+// reduces the surface area of the children. Swaps that would change the depth
+// of the volume or unbalance it are skipped, so the bounds and depth of the
+// volume (and its ancestors) never change. Returns whether a swap was kept.
+func (bvol *BVol) rotate() bool {
+	swaps := make([][2]**BVol, 0, 8)
+	for index, child := range bvol.desc {
+		other := bvol.desc[index^1]
+		if other.depth > 0 {
+			swaps = append(swaps,
+				[2]**BVol{&bvol.desc[index], &other.desc[0]},
+				[2]**BVol{&bvol.desc[index], &other.desc[1]})
+		}
+		if index == 0 && child.depth > 0 && other.depth > 0 {
+			for _, first := range []**BVol{&child.desc[0], &child.desc[1]} {
+				swaps = append(swaps,
+					[2]**BVol{first, &other.desc[0]},
+					[2]**BVol{first, &other.desc[1]})
+			}
+		}
+	}
+
+	// Only the original children change size, whether they stay children or
+	// become grandchildren, so their area tracks the change to the SAH.
+	children := bvol.desc
+	minCost := area.Cost(children[0].vol) + area.Cost(children[1].vol)
+	minSwap := -1
+	for index, swap := range swaps {
+		*swap[0], *swap[1] = *swap[1], *swap[0]
+		if bvol.refitChildren() {
+			cost := area.Cost(children[0].vol) + area.Cost(children[1].vol)
+			if cost < minCost {
+				minCost = cost
+				minSwap = index
+			}
+		}
+		*swap[0], *swap[1] = *swap[1], *swap[0]
+		bvol.refitChildren()
+	}
+
+	if minSwap < 0 {
+		return false
+	}
+	// Pointers into children remain valid, as the swaps above were undone.
+	swap := swaps[minSwap]
+	*swap[0], *swap[1] = *swap[1], *swap[0]
+	bvol.refitChildren()
+	return true
+}
+
+// Recalculates the bounds and depth of the children of a volume. Returns
+// whether the volume is balanced with its depth unchanged.
+func (bvol *BVol) refitChildren() bool {
+	for _, child := range bvol.desc {
+		if child.depth > 0 {
+			child.redepth()
+			child.minBound()
+			if disc.Abs(child.desc[0].depth-child.desc[1].depth) > 1 {
+				return false
+			}
+		}
+	}
+	return disc.Abs(bvol.desc[0].depth-bvol.desc[1].depth) < 2 &&
+		disc.Max(bvol.desc[0].depth, bvol.desc[1].depth)+1 == bvol.depth
+}
+
+// Optimize always measures by surface area, whatever the metric, since it
+// targets the SAH.
+var area AreaMetric
+
+// A max heap of volumes by surface area.
+type byArea []*BVol
+
+func (h byArea) Len() int {
+	return len(h)
+}
+
+func (h byArea) Less(i, j int) bool {
+	return area.Cost(h[i].vol) > area.Cost(h[j].vol)
+}
+
+func (h byArea) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *byArea) Push(x any) {
+	*h = append(*h, x.(*BVol))
+}
+
+func (h *byArea) Pop() any {
+	old := *h
+	bvol := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return bvol
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	orths := randOrths(13, 2000)
+	tree := &BVol{}
+	for _, orth := range orths {
+		tree.Add(orth)
+	}
+	before := tree.SAH()
+	depth := tree.GetDepth()
+
+	rotations := 0
+	for frame := 0; frame < 20; frame++ {
+		sah := tree.SAH()
+		rotations += tree.Optimize(100)
+		if tree.SAH() > sah {
+			t.Errorf("Optimize increased the SAH from %v to %v\n", sah, tree.SAH())
+		}
+	}
+	if rotations == 0 || tree.SAH() >= before {
+		t.Errorf("Optimize made %d rotations, SAH from %v to %v\n", rotations,
+			before, tree.SAH())
+	}
+	if tree.GetDepth() != depth {
+		t.Errorf("Optimize changed the depth from %d to %d\n", depth, tree.GetDepth())
+	}
+	checkTree(t, tree)
+
+	iter := tree.Iterator()
+	for _, orth := range orths {
+		if !iter.Contains(orth) {
+			t.Errorf("Unable to find: %v\n", orth.String())
+		}
+	}
+
+	if (&BVol{}).Optimize(10) != 0 || getIdealTree().Optimize(0) != 0 {
+		t.Errorf("Expected no rotations.\n")
+	}
+}
+
+func TestOptimizeResumes(t *testing.T) {
+	orths := randOrths(13, 2000)
+	tree := &BVol{}
+	for _, orth := range orths {
+		tree.Add(orth)
+	}
+	tree.Optimize(100)
+	first := tree.SAH()
+	// Later calls continue below the volumes the first visited, whichever
+	// iterator they use.
+	for frame := 1; frame < 200; frame++ {
+		if frame%2 == 0 {
+			tree.Optimize(100)
+		} else {
+			tree.Iterator().Optimize(100)
+		}
+	}
+	if tree.SAH() >= first {
+		t.Errorf("Repeated budgets stalled at SAH %v after %v\n", tree.SAH(), first)
+	}
+}
+
+func TestOptimizeUpdates(t *testing.T) {
+	// Updates between calls drop or move the volumes left to visit.
+	orths := randOrths(34, 300)
+	tree := &BVol{}
+	for _, orth := range orths {
+		tree.Add(orth)
+	}
+	region := &Orthotope{Point: [d]int32{0, 0, 0}, Delta: [d]int32{500, 500, 500}}
+	steps := []struct {
+		name   string
+		update func()
+	}{
+		{"RemoveAll", func() { tree.RemoveAll(orths[:150]) }},
+		{"Extract", func() { tree.Merge(tree.Extract(region)) }},
+		{"AddAll", func() { tree.AddAll(orths[:150]) }},
+		{"Remove", func() { tree.Remove(orths[0]) }},
+		{"Add", func() { tree.Add(orths[0]) }},
+		{"Refit", func() { tree.Refit() }},
+		{"Clear", func() { tree.Clear() }},
+		{"Add after Clear", func() {
+			for _, orth := range orths {
+				tree.Add(orth)
+			}
+		}},
+	}
+	for _, step := range steps {
+		tree.Optimize(3)
+		step.update()
+		tree.Optimize(1000)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("Optimizing around %s broke the hierarchy:\n%v\n", step.name,
+				err)
+		}
+	}
+	if tree.Len() != len(orths) {
+		t.Errorf("Length %d, expected %d\n", tree.Len(), len(orths))
+	}
+}
+
+func TestRotate(t *testing.T) {
+	// The leaves are paired badly: each child spans both clusters.
+	near := []*Orthotope{
+		{Point: [d]int32{0, 0, 0}, Delta: [d]int32{1, 1, 1}},
+		{Point: [d]int32{1, 0, 0}, Delta: [d]int32{1, 1, 1}},
+	}
+	far := []*Orthotope{
+		{Point: [d]int32{50, 50, 50}, Delta: [d]int32{1, 1, 1}},
+		{Point: [d]int32{51, 50, 50}, Delta: [d]int32{1, 1, 1}},
+	}
+	joiner := (&BVol{}).Iterator()
+	pair := func(first *Orthotope, second *Orthotope) *BVol {
+		return joiner.join(&BVol{vol: first}, &BVol{vol: second})
+	}
+	tree := joiner.join(pair(near[0], far[0]), pair(near[1], far[1]))
+
+	if tree.Optimize(1) != 1 {
+		t.Errorf("Expected a rotation of:\n%v", tree.String())
+	}
+	expected := joiner.join(pair(near[0], near[1]), pair(far[0], far[1]))
+	if !tree.Equals(expected) {
+		t.Errorf("Unexpected rotation:\n%v\nExpected:\n%v", tree.String(),
+			expected.String())
+	}
+}
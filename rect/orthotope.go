@@ -56,10 +56,11 @@ func (orth *Orthotope) Intersects(o *Orthotope) int32 {
 				p0, p1 = p1, p0
 			}
 			p0T := ((p0 - orth.Point[index]) << ACCURACY) / orth.Delta[index]
-			inT = disc.Max(inT, p0T)
+			inT = max(inT, p0T)
 
+			// Unlike disc.Min, min does not overflow against math.MaxInt32.
 			p1T := ((p1 - orth.Point[index]) << ACCURACY) / orth.Delta[index]
-			outT = disc.Min(outT, p1T)
+			outT = min(outT, p1T)
 		}
 	}
 
@@ -77,7 +78,7 @@ func (o *Orthotope) MinBounds(others ...*Orthotope) {
 		p1 := p0 + o.Delta[index]
 
 		for _, other := range others[1:] {
-			o.Point[index] = disc.Min(p0, other.Point[index])
+			o.Point[index] = disc.Min(o.Point[index], other.Point[index])
 			p1 = disc.Max(p1, other.Point[index]+other.Delta[index])
 		}
 		o.Delta[index] = p1 - o.Point[index]
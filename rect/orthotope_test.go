@@ -95,6 +95,24 @@ func TestIntersects(t *testing.T) {
 	if t2 <= t1 {
 		t.Errorf("Expected distance to be greater than %v, got %v.", t1, t2)
 	}
+
+	// The orthotope is behind the vector.
+	behind := &Orthotope{Point: [d]int32{2, 2}, Delta: [d]int32{2, 2}}
+	vector = &Orthotope{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}}
+	if t4 := vector.Intersects(behind); t4 != expected {
+		t.Errorf("Expected %v, got %v.", expected, t4)
+	}
+}
+
+func TestIntersectsOverflow(t *testing.T) {
+	// Intersects starts the exit distance at math.MaxInt32. The box lies behind
+	// the vector along x, so its exit distance there is negative, and
+	// disc.Min(math.MaxInt32, negative) overflows to math.MaxInt32.
+	vector := &Orthotope{Point: [d]int32{10, 0}, Delta: [d]int32{1, 0}}
+	behind := &Orthotope{Point: [d]int32{0, -1}, Delta: [d]int32{2, 2}}
+	if distance := vector.Intersects(behind); distance != -1 {
+		t.Errorf("Expected -1 for a volume behind the vector, got %v.", distance)
+	}
 }
 
 func TestMinBounds(t *testing.T) {
@@ -113,6 +131,14 @@ func TestMinBounds(t *testing.T) {
 	if !reflect.DeepEqual(o2, o2Orig) {
 		t.Errorf("Orthotope %v unintenitionally modified to %v.", o2Orig, o2)
 	}
+
+	// The lowest point belongs to neither the first nor the last orthotope.
+	o4 := &Orthotope{Point: [d]int32{-30, 0}, Delta: [d]int32{5, 5}}
+	o1.MinBounds(o2, o4, o3)
+	expected = &Orthotope{Point: [d]int32{-30, -20}, Delta: [d]int32{65, 55}}
+	if !reflect.DeepEqual(o1, expected) {
+		t.Errorf("Expected %v and %v doesn't match.", o1, expected)
+	}
 }
 
 func TestOrthString(t *testing.T) {
@@ -0,0 +1,48 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+// Persistent updates copy the volumes along the path to the changed leaf, plus
+// the siblings touched while rebalancing, and share every other volume with the
+// original hierarchy. Old roots stay valid snapshots that readers may query
+// without locks for as long as they like. Do not Add or Remove in place on a
+// hierarchy that shares volumes with a snapshot.
+
+// Returns an iterator over a copy of the root that records which volumes it owns.
+func (bvol *BVol) copyIterator() *orthStack {
+	root := bvol.copyNode()
+	root.tree = bvol.tree.settings()
+	s := root.Iterator()
+	s.owned = map[*BVol]bool{root: true}
+	return s
+}
+
+// CopyAdd returns a new hierarchy containing orth, leaving bvol unchanged. When
+// orth is already present it returns bvol and false.
+func (bvol *BVol) CopyAdd(orth *Orthotope) (*BVol, bool) {
+	s := bvol.copyIterator()
+	if !s.Add(orth) {
+		return bvol, false
+	}
+	return s.bvh, true
+}
+
+// CopyRemove returns a new hierarchy without orth, leaving bvol unchanged. When
+// orth is not present it returns bvol and false.
+func (bvol *BVol) CopyRemove(orth *Orthotope) (*BVol, bool) {
+	s := bvol.copyIterator()
+	if !s.Remove(orth) {
+		return bvol, false
+	}
+	return s.bvh, true
+}
+
+// CopyUpdate returns a new hierarchy where orth has been replaced by moved,
+// leaving bvol unchanged. When orth is not present, or moved already is, it
+// returns bvol and false.
+func (bvol *BVol) CopyUpdate(orth *Orthotope, moved *Orthotope) (*BVol, bool) {
+	s := bvol.copyIterator()
+	if !s.Remove(orth) || !s.Add(moved) {
+		return bvol, false
+	}
+	return s.bvh, true
+}
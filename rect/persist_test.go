@@ -0,0 +1,154 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCopyAdd(t *testing.T) {
+	empty := &BVol{}
+	versions := []*BVol{}
+	strings := []string{}
+	inPlace := &BVol{}
+
+	for _, orth := range leaf {
+		previous := empty
+		if len(versions) > 0 {
+			previous = versions[len(versions)-1]
+		}
+		next, ok := previous.CopyAdd(orth)
+		if !ok {
+			t.Errorf("Unable to add: %v\n", orth.String())
+		}
+		inPlace.Add(orth)
+		if !next.Equals(inPlace) {
+			t.Errorf("Persistent add differs from add in place:\n%v\nExpected:\n%v",
+				next.String(), inPlace.String())
+		}
+		versions = append(versions, next)
+		strings = append(strings, next.String())
+	}
+
+	if next, ok := versions[len(versions)-1].CopyAdd(leaf[0]); ok ||
+		next != versions[len(versions)-1] {
+		t.Errorf("Incorrectly added existing volume: %v\n", leaf[0].String())
+	}
+
+	// Every snapshot must be unchanged by the additions that followed it.
+	if empty.vol != nil {
+		t.Errorf("Empty snapshot modified:\n%v", empty.String())
+	}
+	for index, version := range versions {
+		if version.String() != strings[index] {
+			t.Errorf("Snapshot %d modified:\n%v\nExpected:\n%v", index,
+				version.String(), strings[index])
+		}
+	}
+}
+
+func TestCopyRemove(t *testing.T) {
+	tree := getIdealTree()
+	inPlace := getIdealTree()
+	original := tree.String()
+
+	current := tree
+	for _, orth := range leaf {
+		next, ok := current.CopyRemove(orth)
+		if !ok {
+			t.Errorf("Unable to remove: %v\n", orth.String())
+		}
+		inPlace.Remove(orth)
+		if inPlace.vol != nil && !next.Equals(inPlace) {
+			t.Errorf("Persistent remove differs from remove in place:\n%v\nExpected:\n%v",
+				next.String(), inPlace.String())
+		}
+		if !current.Iterator().Contains(orth) {
+			t.Errorf("Snapshot lost: %v\n", orth.String())
+		}
+		current = next
+	}
+	if current.vol != nil {
+		t.Errorf("Expected an empty hierarchy, got:\n%v", current.String())
+	}
+	if _, ok := current.CopyRemove(leaf[0]); ok {
+		t.Errorf("Incorrectly removed non-existing volume: %v\n", leaf[0].String())
+	}
+	if tree.String() != original {
+		t.Errorf("Original modified:\n%v\nExpected:\n%v", tree.String(), original)
+	}
+}
+
+func TestCopyUpdate(t *testing.T) {
+	tree := getIdealTree()
+	original := tree.String()
+	moved := &Orthotope{Point: [d]int32{3, 20}, Delta: [d]int32{2, 2}}
+
+	next, ok := tree.CopyUpdate(leaf[1], moved)
+	if !ok {
+		t.Errorf("Unable to update: %v\n", leaf[1].String())
+	}
+	if next.Iterator().Contains(leaf[1]) || !next.Iterator().Contains(moved) {
+		t.Errorf("Update did not move %v:\n%v", leaf[1].String(), next.String())
+	}
+	if tree.String() != original {
+		t.Errorf("Original modified:\n%v\nExpected:\n%v", tree.String(), original)
+	}
+	if _, ok := next.CopyUpdate(leaf[1], moved); ok {
+		t.Errorf("Incorrectly updated missing volume: %v\n", leaf[1].String())
+	}
+}
+
+func TestSnapshotReaders(t *testing.T) {
+	orths := randOrths(2, 1000)
+	var current atomic.Pointer[BVol]
+	current.Store(&BVol{})
+	done := make(chan bool)
+
+	var wait sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := current.Load()
+				before := snapshot.Score()
+				for _, orth := range orths[:50] {
+					for range snapshot.Query(orth) {
+					}
+				}
+				if snapshot.Score() != before {
+					t.Errorf("Snapshot changed while being read.\n")
+				}
+			}
+		}()
+	}
+
+	r := rand.New(rand.NewSource(3))
+	present := []*Orthotope{}
+	for _, orth := range orths {
+		next, _ := current.Load().CopyAdd(orth)
+		present = append(present, orth)
+		if r.Intn(3) == 0 {
+			index := r.Intn(len(present))
+			next, _ = next.CopyRemove(present[index])
+			present = append(present[:index], present[index+1:]...)
+		}
+		current.Store(next)
+	}
+	close(done)
+	wait.Wait()
+
+	for _, orth := range present {
+		if !current.Load().Iterator().Contains(orth) {
+			t.Errorf("Unable to find: %v\n", orth.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+// State shared by every iterator over a hierarchy, held by its root.
+type tree struct {
+	// Chooses where to add and how to rotate. Nil for the default metric.
+	metric Metric
+	// How to search for where to add.
+	insertion Insertion
+	// Volumes and internal bounds freed by removals, reused by additions.
+	freeNodes []*BVol
+	freeVols  []*Orthotope
+	// Updates through the methods of BVol, kept so that they allocate nothing.
+	updater *orthStack
+	// Volumes left to visit by Optimize, kept between calls.
+	optimizing byArea
+}
+
+// Returns new state with the same settings, for a hierarchy derived from this
+// one, or nil if there are none.
+func (t *tree) settings() *tree {
+	if t == nil {
+		return nil
+	}
+	return &tree{metric: t.metric, insertion: t.insertion}
+}
+
+// Returns the state of the hierarchy, creating it on its first update. Only
+// call on the root.
+func (bvol *BVol) state() *tree {
+	if bvol.tree == nil {
+		bvol.tree = &tree{}
+	}
+	return bvol.tree
+}
+
+// Forgets the volumes Optimize has yet to visit, after an update that may have
+// moved or dropped them. Only call on the root.
+func (bvol *BVol) changed() {
+	if bvol.tree != nil {
+		clear(bvol.tree.optimizing)
+		bvol.tree.optimizing = bvol.tree.optimizing[:0]
+	}
+}
+
+// Returns the iterator the root keeps for updates, so that the update methods
+// of BVol reuse the volumes freed by earlier ones.
+func (bvol *BVol) updater() *orthStack {
+	t := bvol.state()
+	if t.updater == nil {
+		t.updater = bvol.Iterator()
+	}
+	return t.updater
+}
+
+// Returns a volume holding orth, reusing one that was freed if possible.
+func (s *orthStack) newNode(orth *Orthotope) *BVol {
+	t := s.bvh.state()
+	if last := len(t.freeNodes) - 1; last >= 0 {
+		bvol := t.freeNodes[last]
+		t.freeNodes[last] = nil
+		t.freeNodes = t.freeNodes[:last]
+		bvol.vol = orth
+		return bvol
+	}
+	return &BVol{vol: orth}
+}
+
+// Returns bounds for an internal volume, reusing ones that were freed if
+// possible.
+func (s *orthStack) newVol() *Orthotope {
+	t := s.bvh.state()
+	if last := len(t.freeVols) - 1; last >= 0 {
+		vol := t.freeVols[last]
+		t.freeVols[last] = nil
+		t.freeVols = t.freeVols[:last]
+		return vol
+	}
+	return &Orthotope{}
+}
+
+// Returns a copy of orth, reusing freed bounds if possible.
+func (s *orthStack) copyVol(orth *Orthotope) *Orthotope {
+	vol := s.newVol()
+	*vol = *orth
+	return vol
+}
+
+// Returns a leaf holding a newly added orth.
+func (s *orthStack) newLeaf(orth *Orthotope) *BVol {
+	bvol := s.newNode(orth)
+	bvol.added = s.copyVol(orth)
+	return bvol
+}
+
+// Moves the orthotope of a leaf into a new leaf, so that the old one may
+// become an internal volume.
+func (s *orthStack) moveLeaf(leaf *BVol) *BVol {
+	bvol := s.newNode(leaf.vol)
+	bvol.added, leaf.added = leaf.added, nil
+	return bvol
+}
+
+// Keeps a volume removed from the hierarchy for reuse. During a persistent
+// update the volume may still be part of an older hierarchy, so it is left to
+// the garbage collector instead.
+func (s *orthStack) freeNode(bvol *BVol) {
+	if s.owned == nil {
+		*bvol = BVol{}
+		t := s.bvh.state()
+		t.freeNodes = append(t.freeNodes, bvol)
+	}
+}
+
+// Keeps the bounds of a removed internal volume, or the copy kept by a removed
+// leaf, for reuse.
+func (s *orthStack) freeVol(vol *Orthotope) {
+	if s.owned == nil {
+		t := s.bvh.state()
+		t.freeVols = append(t.freeVols, vol)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+// Returns how many volumes and bounds the hierarchy keeps for reuse.
+func freed(bvol *BVol) (int, int) {
+	if bvol.tree == nil {
+		return 0, 0
+	}
+	return len(bvol.tree.freeNodes), len(bvol.tree.freeVols)
+}
+
+func TestPoolReuse(t *testing.T) {
+	orths := randOrths(52, 1000)
+	tree := &BVol{}
+	iter := tree.Iterator()
+	for _, orth := range orths {
+		iter.Add(orth)
+	}
+	for _, orth := range orths[:500] {
+		iter.Remove(orth)
+	}
+	// Each removal frees a leaf, its copy of the orthotope, its parent and the
+	// parent's bounds.
+	if nodes, vols := freed(tree); nodes != 1000 || vols != 1000 {
+		t.Errorf("Freed %d volumes and %d bounds, expected 1000 and 1000\n", nodes,
+			vols)
+	}
+	for _, orth := range orths[:500] {
+		iter.Add(orth)
+	}
+	if nodes, vols := freed(tree); nodes != 0 || vols != 0 {
+		t.Errorf("Reused all but %d volumes and %d bounds\n", nodes, vols)
+	}
+	checkTree(t, tree)
+	for _, orth := range orths {
+		if !iter.Contains(orth) {
+			t.Errorf("Lost %v after reusing volumes\n", orth.String())
+		}
+	}
+
+	// Removing down to nothing frees the root's children as well.
+	for _, orth := range orths {
+		iter.Remove(orth)
+	}
+	if nodes, _ := freed(tree); tree.vol != nil || nodes != 2*len(orths)-2 {
+		t.Errorf("Freed %d volumes emptying the hierarchy, expected %d\n", nodes,
+			2*len(orths)-2)
+	}
+
+	// Batch updates reuse the same volumes, through any iterator.
+	tree.AddAll(orths)
+	removed := tree.RemoveAll(orths[:500])
+	if nodes, vols := freed(tree); removed != 500 || nodes < 1000 || vols < 500 {
+		t.Errorf("RemoveAll freed %d volumes and %d bounds, expected at least "+
+			"1000 and 500\n", nodes, vols)
+	}
+	extracted := tree.Extract(&Orthotope{Point: [d]int32{0, 0, 0},
+		Delta: [d]int32{500, 500, 500}})
+	tree.Merge(extracted)
+	if nodes, _ := freed(tree); nodes == 0 {
+		t.Errorf("Extract and Merge freed no volumes\n")
+	}
+	checkTree(t, tree)
+	if tree.Len() != 500 {
+		t.Errorf("Length %d after batch updates, expected 500\n", tree.Len())
+	}
+}
+
+func TestPoolAllocs(t *testing.T) {
+	orths := randOrths(53, 1000)
+	tree := TopDownBVH(orths)
+	iter := tree.Iterator()
+	q := randOrths(54, 1)[0]
+	next := 0
+	allocs := testing.AllocsPerRun(1000, func() {
+		orth := orths[next%len(orths)]
+		next++
+		iter.Remove(orth)
+		iter.Add(orth)
+		iter.Reset()
+		for r := iter.Query(q); r != nil; r = iter.Query(q) {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Add, Remove and Query allocated %v times, expected none\n", allocs)
+	}
+	checkTree(t, tree)
+
+	// Updates through the hierarchy itself reuse volumes as well.
+	allocs = testing.AllocsPerRun(1000, func() {
+		orth := orths[next%len(orths)]
+		next++
+		tree.Remove(orth)
+		tree.Add(orth)
+	})
+	if allocs != 0 {
+		t.Errorf("BVol Add and Remove allocated %v times, expected none\n", allocs)
+	}
+	checkTree(t, tree)
+}
+
+func TestPoolSnapshot(t *testing.T) {
+	orths := randOrths(55, 100)
+	tree := TopDownBVH(orths)
+	snapshot, _ := tree.CopyRemove(orths[0])
+	snapshot, _ = snapshot.CopyAdd(orths[0])
+	// Volumes removed from a snapshot may be shared, so none are kept.
+	iter := snapshot.copyIterator()
+	iter.Remove(orths[1])
+	if nodes, vols := freed(iter.bvh); nodes != 0 || vols != 0 {
+		t.Errorf("Kept volumes removed during a persistent update\n")
+	}
+	checkTree(t, tree)
+	for _, orth := range orths {
+		if !tree.Iterator().Contains(orth) {
+			t.Errorf("Snapshot removal changed the original hierarchy\n")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+// Refit recalculates the bounds of every volume from its children in one
+// post-order pass, for use after the orthotopes in the hierarchy have been
+// modified in place, and accepts those modifications so that RemoveChecked and
+// Validate no longer report them. The shape of the hierarchy is unchanged, so a
+// refit after large movements may leave it far from optimal.
+func (bvol *BVol) Refit() {
+	bvol.changed()
+	bvol.refit()
+}
+
+func (bvol *BVol) refit() {
+	if bvol.depth == 0 && bvol.vol != nil {
+		bvol.accept()
+	} else if bvol.depth > 0 {
+		bvol.desc[0].refit()
+		bvol.desc[1].refit()
+		bvol.redepth()
+		bvol.minBound()
+	}
+}
+
+// RefitLeaves recalculates the bounds of the volumes containing the given
+// orthotopes after they have been modified in place, and returns how many were
+// found, accepting their modifications as Refit does. Modified orthotopes can
+// not be found through their old bounds, so the
+// hierarchy is searched until all are found, but only their ancestors are
+// recalculated.
+func (bvol *BVol) RefitLeaves(orths ...*Orthotope) int {
+	moved := make(map[*Orthotope]bool, len(orths))
+	for _, orth := range orths {
+		moved[orth] = true
+	}
+	remaining := len(moved)
+	bvol.changed()
+	bvol.refitLeaves(moved, &remaining)
+	return len(moved) - remaining
+}
+
+// Keeps the current bounds of a leaf as those it was added with.
+func (bvol *BVol) accept() {
+	if bvol.added == nil {
+		bvol.added = &Orthotope{}
+	}
+	*bvol.added = *bvol.vol
+}
+
+// Refits the ancestors of moved leaves until none remain. Returns whether a
+// moved leaf was found below this volume.
+func (bvol *BVol) refitLeaves(moved map[*Orthotope]bool, remaining *int) bool {
+	if bvol.depth == 0 {
+		if bvol.vol != nil && moved[bvol.vol] {
+			bvol.accept()
+			*remaining--
+			return true
+		}
+		return false
+	}
+	found := false
+	for _, child := range bvol.desc {
+		if *remaining > 0 && child.refitLeaves(moved, remaining) {
+			found = true
+		}
+	}
+	if found {
+		bvol.minBound()
+	}
+	return found
+}
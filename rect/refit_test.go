@@ -0,0 +1,57 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"testing"
+)
+
+func TestRefit(t *testing.T) {
+	orths := randOrths(14, 500)
+	tree := TopDownBVH(append([]*Orthotope{}, orths...))
+	depth := tree.GetDepth()
+
+	// Re-center everything, which leaves every bound stale.
+	for _, orth := range orths {
+		orth.Point[0] -= 500
+		orth.Point[1] += 250
+	}
+	tree.Refit()
+	checkTree(t, tree)
+	if tree.GetDepth() != depth {
+		t.Errorf("Refit changed the depth from %d to %d\n", depth, tree.GetDepth())
+	}
+
+	iter := tree.Iterator()
+	for _, orth := range orths {
+		if !iter.Contains(orth) {
+			t.Errorf("Unable to find: %v\n", orth.String())
+		}
+	}
+	(&BVol{}).Refit()
+}
+
+func TestRefitLeaves(t *testing.T) {
+	tree := getIdealTree()
+	original := tree.String()
+	saved4, saved9 := *leaf[4], *leaf[9]
+	defer func() {
+		*leaf[4], *leaf[9] = saved4, saved9
+	}()
+	leaf[4].Point[0] = 40
+	leaf[9].Point[1] = 30
+
+	missing := &Orthotope{Point: [d]int32{1, 1}, Delta: [d]int32{1, 1}}
+	if found := tree.RefitLeaves(leaf[4], leaf[9], missing); found != 2 {
+		t.Errorf("Refit found %d moved volumes, expected 2\n", found)
+	}
+	checkTree(t, tree)
+	iter := tree.Iterator()
+	for _, orth := range leaf {
+		if !iter.Contains(orth) {
+			t.Errorf("Unable to find: %v\n", orth.String())
+		}
+	}
+	if tree.String() == original {
+		t.Errorf("Refit left bounds unchanged:\n%v", tree.String())
+	}
+}
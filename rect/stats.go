@@ -0,0 +1,95 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Stats describe the shape and quality of a hierarchy.
+type Stats struct {
+	Leaves   int
+	Internal int
+	// Leaf depths count levels down from the root, which has a depth of 0.
+	MinLeafDepth int
+	MaxLeafDepth int
+	AvgLeafDepth float64
+	// The number of leaves at each depth.
+	DepthHistogram []int
+	// Volume shared by the children of each internal volume, in total and on
+	// average per internal volume.
+	Overlap    int64
+	AvgOverlap float64
+	// The SAH with the same costs as BVol.SAH, measured without dividing by
+	// extents so that flat volumes are allowed. Zero when the root has no area.
+	SAH float64
+	// Bytes of volumes, internal bounds and the copies leaves keep of their
+	// orthotopes as added. Leaf orthotopes belong to the caller and are not
+	// counted.
+	Bytes int
+}
+
+// Stats walks the hierarchy to gather statistics about it.
+func (bvol *BVol) Stats() Stats {
+	stats := Stats{}
+	if bvol.vol == nil {
+		return stats
+	}
+	var internalArea, leafArea int64
+	var depths int
+	var walk func(node *BVol, level int)
+	walk = func(node *BVol, level int) {
+		if node.depth == 0 {
+			stats.Leaves++
+			leafArea += area.Cost(node.vol)
+			depths += level
+			for len(stats.DepthHistogram) <= level {
+				stats.DepthHistogram = append(stats.DepthHistogram, 0)
+			}
+			stats.DepthHistogram[level]++
+			return
+		}
+		stats.Internal++
+		internalArea += area.Cost(node.vol)
+		stats.Overlap += overlap(node.desc[0].vol, node.desc[1].vol)
+		walk(node.desc[0], level+1)
+		walk(node.desc[1], level+1)
+	}
+	walk(bvol, 0)
+
+	stats.MinLeafDepth = len(stats.DepthHistogram)
+	for level, count := range stats.DepthHistogram {
+		if count > 0 {
+			stats.MinLeafDepth = min(stats.MinLeafDepth, level)
+			stats.MaxLeafDepth = level
+		}
+	}
+	stats.AvgLeafDepth = float64(depths) / float64(stats.Leaves)
+	if stats.Internal > 0 {
+		stats.AvgOverlap = float64(stats.Overlap) / float64(stats.Internal)
+	}
+	if rootArea := area.Cost(bvol.vol); rootArea > 0 {
+		stats.SAH = (1.0*float64(internalArea) + 1.2*float64(leafArea)) /
+			float64(rootArea)
+	}
+	stats.Bytes = (stats.Leaves+stats.Internal)*int(unsafe.Sizeof(BVol{})) +
+		(stats.Internal+stats.Leaves)*int(unsafe.Sizeof(Orthotope{}))
+	return stats
+}
+
+// String formats the statistics as a report, one statistic per line.
+func (s Stats) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "leaves: %d\n", s.Leaves)
+	fmt.Fprintf(b, "internal: %d\n", s.Internal)
+	fmt.Fprintf(b, "leaf depth: min %d, avg %.2f, max %d\n", s.MinLeafDepth,
+		s.AvgLeafDepth, s.MaxLeafDepth)
+	for level, count := range s.DepthHistogram {
+		fmt.Fprintf(b, "  %3d: %d\n", level, count)
+	}
+	fmt.Fprintf(b, "overlap: total %d, avg %.2f\n", s.Overlap, s.AvgOverlap)
+	fmt.Fprintf(b, "SAH: %.4f\n", s.SAH)
+	fmt.Fprintf(b, "bytes: %d\n", s.Bytes)
+	return b.String()
+}
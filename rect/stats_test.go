@@ -0,0 +1,47 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	stats := getIdealTree().Stats()
+	if stats.Leaves != len(leaf) || stats.Internal != len(leaf)-1 {
+		t.Errorf("Counted %d leaves and %d internal volumes, expected %d and %d\n",
+			stats.Leaves, stats.Internal, len(leaf), len(leaf)-1)
+	}
+	if stats.MinLeafDepth != 3 || stats.MaxLeafDepth != 4 {
+		t.Errorf("Leaf depths from %d to %d, expected 3 to 4\n",
+			stats.MinLeafDepth, stats.MaxLeafDepth)
+	}
+	histogram := []int{0, 0, 0, 6, 4}
+	for level, count := range histogram {
+		if level >= len(stats.DepthHistogram) || stats.DepthHistogram[level] != count {
+			t.Errorf("Depth histogram %v, expected %v\n", stats.DepthHistogram,
+				histogram)
+			break
+		}
+	}
+	if stats.AvgLeafDepth != 3.4 {
+		t.Errorf("Average leaf depth %v, expected 3.4\n", stats.AvgLeafDepth)
+	}
+	if !strings.Contains(stats.String(), "leaves: 10\n") {
+		t.Errorf("Report does not list the leaves:\n%v\n", stats.String())
+	}
+
+	tree := TopDownBVH(randOrths(70, 1000))
+	stats = tree.Stats()
+	if math.Abs(stats.SAH-tree.SAH()) > 1e-9 {
+		t.Errorf("Stats SAH %v, expected %v\n", stats.SAH, tree.SAH())
+	}
+	if stats.Overlap <= 0 || stats.Bytes <= 0 {
+		t.Errorf("Expected overlap and bytes, got %d and %d\n", stats.Overlap,
+			stats.Bytes)
+	}
+	if empty := (&BVol{}).Stats(); empty.Leaves != 0 || empty.DepthHistogram != nil {
+		t.Errorf("Stats of an empty hierarchy: %+v\n", empty)
+	}
+}
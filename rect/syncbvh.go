@@ -0,0 +1,111 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"iter"
+	"sync"
+)
+
+// SyncBVol guards a BVol for use by many goroutines. Queries share a read lock
+// while additions and removals take the write lock. Each operation borrows an
+// iterator from a pool, so goroutines never share traversal state.
+type SyncBVol struct {
+	lock  sync.RWMutex
+	bvol  *BVol
+	iters sync.Pool
+}
+
+// NewSyncBVol wraps bvol, or a new empty hierarchy when bvol is nil. The
+// caller must not use bvol directly once it has been wrapped.
+func NewSyncBVol(bvol *BVol) *SyncBVol {
+	if bvol == nil {
+		bvol = &BVol{}
+	}
+	t := &SyncBVol{bvol: bvol}
+	t.iters.New = func() any {
+		return t.bvol.Iterator()
+	}
+	return t
+}
+
+func (t *SyncBVol) iterator() *orthStack {
+	return t.iters.Get().(*orthStack)
+}
+
+// Add an orthotope to the hierarchy.
+func (t *SyncBVol) Add(orth *Orthotope) bool {
+	s := t.iterator()
+	defer t.iters.Put(s)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return s.Add(orth)
+}
+
+// Remove an orthotope from the hierarchy.
+func (t *SyncBVol) Remove(orth *Orthotope) bool {
+	s := t.iterator()
+	defer t.iters.Put(s)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return s.Remove(orth)
+}
+
+// RemoveChecked removes an orthotope, even one modified in place, reporting
+// ErrMutated if it was or ErrNotFound if it is not in the hierarchy. An
+// orthotope not found through its bounds, whether modified or never added, is
+// searched for through every volume, so a miss costs O(n).
+func (t *SyncBVol) RemoveChecked(orth *Orthotope) error {
+	s := t.iterator()
+	defer t.iters.Put(s)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return s.RemoveChecked(orth)
+}
+
+// Contains checks whether the orthotope is in the hierarchy.
+func (t *SyncBVol) Contains(orth *Orthotope) bool {
+	s := t.iterator()
+	defer t.iters.Put(s)
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return s.Contains(orth)
+}
+
+// Len returns the number of orthotopes in the hierarchy.
+func (t *SyncBVol) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.bvol.Len()
+}
+
+// Query returns a sequence of the orthotopes that overlap o. The read lock is
+// held until the loop ends, so the loop body must not Add or Remove.
+func (t *SyncBVol) Query(o *Orthotope) iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		s := t.iterator()
+		defer t.iters.Put(s)
+		t.lock.RLock()
+		defer t.lock.RUnlock()
+		s.query(o, yield)
+	}
+}
+
+// Trace returns a sequence of the orthotopes intersected by the vector o. The
+// read lock is held until the loop ends, so the loop body must not Add or Remove.
+func (t *SyncBVol) Trace(o *Orthotope) iter.Seq2[*Orthotope, int32] {
+	return func(yield func(*Orthotope, int32) bool) {
+		s := t.iterator()
+		defer t.iters.Put(s)
+		t.lock.RLock()
+		defer t.lock.RUnlock()
+		s.trace(o, yield)
+	}
+}
+
+// View calls fn with the hierarchy under the read lock, for reads such as
+// Score or SAH. fn must not modify the hierarchy or keep it after returning.
+func (t *SyncBVol) View(fn func(bvol *BVol)) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	fn(t.bvol)
+}
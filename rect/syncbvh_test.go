@@ -0,0 +1,80 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSyncBVol(t *testing.T) {
+	const workers = 8
+	orths := randOrths(1, workers*200)
+	tree := NewSyncBVol(nil)
+	all := &Orthotope{Point: [d]int32{-1, -1, -1}, Delta: [d]int32{2000, 2000, 2000}}
+
+	var wait sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		mine := orths[w*200 : (w+1)*200]
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			// Add everything, then remove every other volume.
+			for _, orth := range mine {
+				if !tree.Add(orth) {
+					t.Errorf("Unable to add: %v\n", orth.String())
+				}
+			}
+			for i := 0; i < len(mine); i += 2 {
+				if !tree.Remove(mine[i]) {
+					t.Errorf("Unable to remove: %v\n", mine[i].String())
+				}
+			}
+		}()
+		go func() {
+			defer wait.Done()
+			for i, orth := range mine {
+				for r := range tree.Query(orth) {
+					if !r.Overlaps(orth) {
+						t.Errorf("Querying %v returned %v\n", orth.String(), r.String())
+					}
+				}
+				for range tree.Trace(all) {
+					break
+				}
+				tree.Contains(mine[len(mine)-1-i])
+			}
+		}()
+	}
+	wait.Wait()
+
+	count := 0
+	for range tree.Query(all) {
+		count++
+	}
+	if count != len(orths)/2 || tree.Len() != count {
+		t.Errorf("Expected %d volumes after removal, found %d of length %d\n",
+			len(orths)/2, count, tree.Len())
+	}
+	for i, orth := range orths {
+		if tree.Contains(orth) != (i%2 == 1) {
+			t.Errorf("Unexpected membership for %v\n", orth.String())
+		}
+	}
+	tree.View(func(bvol *BVol) {
+		if bvol.GetDepth() > 16 {
+			t.Errorf("Unbalanced hierarchy of depth %d\n", bvol.GetDepth())
+		}
+	})
+}
+
+func TestSyncBVolWrap(t *testing.T) {
+	tree := NewSyncBVol(getIdealTree())
+	for _, orth := range leaf {
+		if !tree.Contains(orth) {
+			t.Errorf("Unable to find: %v\n", orth.String())
+		}
+	}
+	if tree.Add(leaf[0]) {
+		t.Errorf("Incorrectly added existing volume: %v\n", leaf[0].String())
+	}
+}
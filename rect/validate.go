@@ -0,0 +1,76 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate walks the hierarchy and reports every broken invariant, or nil if
+// there are none: each volume must contain its children, have a depth one more
+// than its deepest child, count the leaves below it, and have children whose
+// depths differ by at most one. Each leaf must hold its orthotope unmodified
+// since it was added, or since the last refit.
+// Volumes are named by their path from the root, such as "root.0.1" for the
+// second child of the first child of the root.
+func (bvol *BVol) Validate() error {
+	if bvol.vol == nil {
+		if bvol.depth != 0 {
+			return fmt.Errorf("rect: empty root has depth %d", bvol.depth)
+		}
+		return nil
+	}
+	errs := []error{}
+	bvol.validate("root", &errs)
+	return errors.Join(errs...)
+}
+
+func (bvol *BVol) validate(path string, errs *[]error) {
+	if bvol.depth < 0 {
+		*errs = append(*errs, fmt.Errorf("rect: volume %s has depth %d", path,
+			bvol.depth))
+	}
+	if bvol.depth == 0 && bvol.added == nil {
+		*errs = append(*errs, fmt.Errorf("rect: leaf %s keeps no copy of its orthotope",
+			path))
+	} else if bvol.depth == 0 && bvol.mutated() {
+		*errs = append(*errs, fmt.Errorf("rect: leaf %s was modified in place from %v to %v",
+			path, bvol.added.String(), bvol.vol.String()))
+	}
+	if bvol.depth <= 0 {
+		return
+	}
+
+	missing := false
+	for index, child := range bvol.desc {
+		childPath := fmt.Sprintf("%s.%d", path, index)
+		if child == nil || child.vol == nil {
+			*errs = append(*errs, fmt.Errorf("rect: volume %s is missing", childPath))
+			missing = true
+			continue
+		}
+		if !bvol.vol.Contains(child.vol) {
+			*errs = append(*errs, fmt.Errorf("rect: volume %s (%v) does not contain %s (%v)",
+				path, bvol.vol.String(), childPath, child.vol.String()))
+		}
+		child.validate(childPath, errs)
+	}
+	if missing {
+		return
+	}
+
+	d0, d1 := bvol.desc[0].depth, bvol.desc[1].depth
+	if depth := max(d0, d1) + 1; bvol.depth != depth {
+		*errs = append(*errs, fmt.Errorf("rect: volume %s has depth %d, expected %d",
+			path, bvol.depth, depth))
+	}
+	if count := bvol.desc[0].leaves() + bvol.desc[1].leaves(); bvol.count != count {
+		*errs = append(*errs, fmt.Errorf("rect: volume %s counts %d leaves, expected %d",
+			path, bvol.count, count))
+	}
+	if d0-d1 > 1 || d1-d0 > 1 {
+		*errs = append(*errs, fmt.Errorf(
+			"rect: volume %s is unbalanced with children of depth %d and %d",
+			path, d0, d1))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tree := range []*BVol{{}, getIdealTree(), TopDownBVH(randOrths(68, 1000))} {
+		if err := tree.Validate(); err != nil {
+			t.Errorf("Valid hierarchy reported: %v\n", err)
+		}
+	}
+	tree := &BVol{}
+	iter := tree.Iterator()
+	orths := randOrths(69, 500)
+	for _, orth := range orths {
+		iter.Add(orth)
+	}
+	for _, orth := range orths[:250] {
+		iter.Remove(orth)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Errorf("Hierarchy after Add and Remove reported: %v\n", err)
+	}
+}
+
+func TestValidateBroken(t *testing.T) {
+	tree := getIdealTree()
+	// Grow a leaf past its parent, make a depth stale and unbalance a volume.
+	tree.desc[0].desc[1].desc[0].desc[0].vol = &Orthotope{Point: [d]int32{-50, 0},
+		Delta: [d]int32{1, 1}}
+	tree.desc[1].depth = 5
+	tree.desc[1].desc[1].count = 3
+	tree.desc[0].desc[0] = tree.desc[0].desc[0].desc[0]
+
+	err := tree.Validate()
+	if err == nil {
+		t.Fatalf("Broken hierarchy reported no errors\n")
+	}
+	for _, expected := range []string{
+		"volume root.0.1.0 (", "does not contain root.0.1.0.0",
+		"volume root.1 has depth 5, expected 2",
+		"volume root.1.1 counts 3 leaves, expected 2",
+		"volume root has depth 4, expected 6",
+		"volume root is unbalanced",
+		"volume root.0 is unbalanced",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Validate did not report %q in:\n%v\n", expected, err)
+		}
+	}
+
+	missing := getIdealTree()
+	missing.desc[1].desc[0] = nil
+	if err := missing.Validate(); err == nil ||
+		!strings.Contains(err.Error(), "volume root.1.0 is missing") {
+		t.Errorf("Validate did not report a missing volume: %v\n", err)
+	}
+
+	mutated := getIdealTree()
+	mutated.desc[1].desc[1].desc[0].vol.Delta[0]--
+	if err := mutated.Validate(); err == nil ||
+		!strings.Contains(err.Error(), "leaf root.1.1.0 was modified in place") {
+		t.Errorf("Validate did not report a leaf modified in place: %v\n", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"iter"
+)
+
+// A WideBVol is a read-only copy of a BVol collapsed so that each volume has
+// up to width children, which are stored side by side and tested together.
+// Wider volumes mean fewer levels to descend and less pointer chasing.
+type WideBVol struct {
+	nodes    []wideNode
+	children []wideChild
+}
+
+// The children of a wide volume are children[first : first+count].
+type wideNode struct {
+	first int32
+	count int32
+}
+
+// A child holds a copy of its bounds, and either the index of its wide volume
+// or, for leaves, a node of -1 and the orthotope.
+type wideChild struct {
+	vol  Orthotope
+	node int32
+	leaf *Orthotope
+}
+
+// Collapse copies the hierarchy into a WideBVol with up to width children per
+// volume, typically 4 or 8. Each volume takes the place of the binary volumes
+// below it with the largest surface areas. Changes to bvol are not reflected.
+func (bvol *BVol) Collapse(width int) *WideBVol {
+	w := &WideBVol{}
+	if bvol.vol == nil {
+		return w
+	}
+	if bvol.depth == 0 {
+		w.nodes = []wideNode{{first: 0, count: 1}}
+		w.children = []wideChild{{vol: *bvol.vol, node: -1, leaf: bvol.vol}}
+		return w
+	}
+	w.collapse(bvol, max(width, 2))
+	return w
+}
+
+// Appends a wide volume for the binary volume and those below it.
+func (w *WideBVol) collapse(bvol *BVol, width int) int32 {
+	// Replace the largest binary volume by its children until full.
+	frontier := []*BVol{bvol.desc[0], bvol.desc[1]}
+	for len(frontier) < width {
+		largest := -1
+		for index, f := range frontier {
+			if f.depth > 0 && (largest < 0 ||
+				area.Cost(f.vol) > area.Cost(frontier[largest].vol)) {
+				largest = index
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		split := frontier[largest]
+		frontier[largest] = split.desc[0]
+		frontier = append(frontier, split.desc[1])
+	}
+
+	index := int32(len(w.nodes))
+	first := int32(len(w.children))
+	w.nodes = append(w.nodes, wideNode{first: first, count: int32(len(frontier))})
+	for _, f := range frontier {
+		w.children = append(w.children, wideChild{vol: *f.vol, node: -1, leaf: f.vol})
+	}
+	for offset, f := range frontier {
+		if f.depth > 0 {
+			// Collapse before indexing, since it may grow children.
+			node := w.collapse(f, width)
+			w.children[first+int32(offset)].node = node
+			w.children[first+int32(offset)].leaf = nil
+		}
+	}
+	return index
+}
+
+// Query returns a sequence of the orthotopes that overlap o.
+func (w *WideBVol) Query(o *Orthotope) iter.Seq[*Orthotope] {
+	return func(yield func(*Orthotope) bool) {
+		if len(w.nodes) == 0 {
+			return
+		}
+		stack := make([]int32, 1, 64)
+		for len(stack) > 0 {
+			node := w.nodes[stack[len(stack)-1]]
+			stack = stack[:len(stack)-1]
+			for i := node.first; i < node.first+node.count; i++ {
+				child := &w.children[i]
+				if !child.vol.Overlaps(o) {
+					continue
+				}
+				if child.node >= 0 {
+					stack = append(stack, child.node)
+				} else if !yield(child.leaf) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// A child of a wide volume intersected by a traced vector.
+type wideHit struct {
+	child    int32
+	distance int32
+}
+
+// Trace returns a sequence of the orthotopes intersected by the vector o along
+// with their distances, nearest branches first.
+func (w *WideBVol) Trace(o *Orthotope) iter.Seq2[*Orthotope, int32] {
+	return func(yield func(*Orthotope, int32) bool) {
+		if len(w.nodes) == 0 {
+			return
+		}
+		stack := make([]wideHit, 0, 64)
+		stack = w.traceNode(o, 0, stack)
+		for len(stack) > 0 {
+			hit := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			child := &w.children[hit.child]
+			if child.node >= 0 {
+				stack = w.traceNode(o, child.node, stack)
+			} else if !yield(child.leaf, hit.distance) {
+				return
+			}
+		}
+	}
+}
+
+// Pushes the children of a wide volume intersected by o, farthest first, so
+// that the nearest is popped first.
+func (w *WideBVol) traceNode(o *Orthotope, index int32, stack []wideHit) []wideHit {
+	node := w.nodes[index]
+	start := len(stack)
+	for i := node.first; i < node.first+node.count; i++ {
+		distance := o.Intersects(&w.children[i].vol)
+		if distance < 0 {
+			continue
+		}
+		// Insertion sort, as there are only a few children.
+		stack = append(stack, wideHit{child: i, distance: distance})
+		for j := len(stack) - 1; j > start && stack[j-1].distance < distance; j-- {
+			stack[j], stack[j-1] = stack[j-1], stack[j]
+		}
+	}
+	return stack
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Brian Noyama. Subject to the the Apache License, Version 2.0.
+package rect
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Collects a sequence of orthotopes into a set.
+func collect(seq func(func(*Orthotope) bool)) map[*Orthotope]bool {
+	found := map[*Orthotope]bool{}
+	for orth := range seq {
+		found[orth] = true
+	}
+	return found
+}
+
+// Collects a sequence of traced orthotopes into a set, checking distances.
+func collectTrace(t *testing.T, o *Orthotope,
+	seq func(func(*Orthotope, int32) bool)) map[*Orthotope]bool {
+	found := map[*Orthotope]bool{}
+	for orth, distance := range seq {
+		if distance != o.Intersects(orth) {
+			t.Errorf("Tracing %v returned distance %d for %v\n", o.String(),
+				distance, orth.String())
+		}
+		found[orth] = true
+	}
+	return found
+}
+
+func sameSet(first map[*Orthotope]bool, second map[*Orthotope]bool) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for orth := range first {
+		if !second[orth] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCollapse(t *testing.T) {
+	tree := TopDownBVH(randOrths(20, 3000))
+	queries := randOrths(21, 200)
+	for _, width := range []int{2, 4, 8} {
+		wide := tree.Collapse(width)
+		for _, node := range wide.nodes {
+			if node.count < 2 || int(node.count) > width {
+				t.Errorf("Wide volume with %d children, expected 2 to %d\n",
+					node.count, width)
+			}
+		}
+		for _, q := range queries {
+			if !sameSet(collect(wide.Query(q)), collect(tree.Query(q))) {
+				t.Errorf("Width %d query %v differs from the binary tree\n",
+					width, q.String())
+			}
+		}
+	}
+
+	// Tracing the ideal tree should find the same volumes in the same order.
+	wide := getIdealTree().Collapse(4)
+	q := &Orthotope{Point: [d]int32{7, 20}, Delta: [d]int32{4, -5}}
+	results := []*Orthotope{leaf[7], leaf[3], leaf[2]}
+	for r := range wide.Trace(q) {
+		if len(results) > 0 && results[0] == r {
+			results = results[1:]
+		} else {
+			t.Errorf("Tracing %v returned unexpected or out of order value: %v\n",
+				q.String(), r.String())
+		}
+	}
+	for _, orth := range results {
+		t.Errorf("Tracing %v did not return %v\n", q.String(), orth.String())
+	}
+}
+
+func TestCollapseSmall(t *testing.T) {
+	for r := range (&BVol{}).Collapse(4).Query(leaf[0]) {
+		t.Errorf("Querying an empty hierarchy returned %v\n", r.String())
+	}
+	single := &BVol{}
+	single.Add(leaf[0])
+	if found := collect(single.Collapse(4).Query(leaf[0])); !found[leaf[0]] {
+		t.Errorf("Querying a single leaf did not return it.\n")
+	}
+	ray := &Orthotope{Point: [d]int32{-2, 0}, Delta: [d]int32{4, 2}}
+	if found := collectTrace(t, ray, single.Collapse(8).Trace(ray)); !found[leaf[0]] {
+		t.Errorf("Tracing a single leaf did not return it.\n")
+	}
+}
+
+func TestCollapseTrace(t *testing.T) {
+	tree := TopDownBVH(randOrths(22, 2000))
+	rays := randOrths(23, 50)
+	wide := tree.Collapse(8)
+	for _, ray := range rays {
+		ray.Delta[2] = -ray.Delta[2]
+		if !sameSet(collectTrace(t, ray, wide.Trace(ray)),
+			collectTrace(t, ray, tree.Trace(ray))) {
+			t.Errorf("Trace %v differs from the binary tree\n", ray.String())
+		}
+	}
+}
+
+func BenchmarkWideQuery(b *testing.B) {
+	tree := TopDownBVH(randOrths(24, 50000))
+	queries := randOrths(25, 1000)
+	b.Run("binary", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range tree.Query(queries[n%len(queries)]) {
+			}
+		}
+	})
+	for _, width := range []int{4, 8} {
+		wide := tree.Collapse(width)
+		b.Run(fmt.Sprintf("width=%d", width), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for range wide.Query(queries[n%len(queries)]) {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWideTrace(b *testing.B) {
+	tree := TopDownBVH(randOrths(26, 50000))
+	rays := randOrths(27, 1000)
+	b.Run("binary", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for range tree.Trace(rays[n%len(rays)]) {
+				break
+			}
+		}
+	})
+	for _, width := range []int{4, 8} {
+		wide := tree.Collapse(width)
+		b.Run(fmt.Sprintf("width=%d", width), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for range wide.Trace(rays[n%len(rays)]) {
+					break
+				}
+			}
+		})
+	}
+}